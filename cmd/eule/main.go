@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 
@@ -8,16 +10,52 @@ import (
 	"github.com/Unheilbar/eulang/eulvm"
 )
 
+const gasLimit = 10_000_000
+
+var (
+	debug = flag.Bool("debug", false, "run the program in the debugger reading commands from stdin")
+	trace = flag.Bool("trace", false, "write json trace of the execution into stderr")
+)
+
 func main() {
-	file := os.Args[1]
+	flag.Parse()
+	args := flag.Args()
+	file := args[0]
 	eulang := compiler.NewEulang()
 	prog := compiler.CompileFromSource(eulang, file)
-	//e := eulvm.New(prog).WithDebug()
-	e := eulvm.New(prog)
-	input := eulang.GenerateInput(os.Args[2], os.Args[3:])
+	e, err := eulvm.NewVerified(prog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *trace {
+		e.WithTracer(eulvm.NewJSONTracer(os.Stderr).WithSourceMap(prog.SourceMap))
+	}
+	input := eulang.GenerateInput(args[1], args[2:])
 
-	err := e.Run(input)
+	var res eulvm.Result
+	if *debug {
+		d := e.Debugger()
+		d.Start(input, gasLimit)
+		err = d.REPL(os.Stdin, os.Stdout)
+		if err == nil && !d.Finished() {
+			log.Fatal("debugging stopped before the program finished")
+		}
+		res = d.Result()
+	} else {
+		res, err = e.Run(input, gasLimit)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	for _, l := range res.Logs {
+		fmt.Fprintln(os.Stderr, "log:", eulang.FormatLog(l))
+	}
+	if res.ReturnData != nil {
+		fmt.Fprintln(os.Stderr, "return:", eulang.FormatReturn(args[1], res.ReturnData))
+	}
+
+	if root, ok := e.StateRoot(); ok {
+		fmt.Fprintln(os.Stderr, "state root:", root.Hex())
+	}
 }
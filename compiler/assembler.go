@@ -0,0 +1,250 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Unheilbar/eulang/eulvm"
+	"github.com/Unheilbar/eulang/utils"
+	"github.com/holiman/uint256"
+)
+
+// Easm source is a list of lines, each line is one of:
+//
+//	// comment (';' starts a comment as well)
+//	.data 0x0102 0x03     appends hex encoded bytes to preallocated memory of the program
+//	loop:                 label of the next instruction, can be followed by instruction on the same line
+//	PUSH 0x20             opcode with optional operand
+//
+// Operands are decimal or hex (0x prefixed) numbers up to 256 bits.
+// JUMPDEST, JUMPI and CALL accept labels as operands.
+const (
+	labelSfx      = ":"
+	dataDirective = ".data"
+)
+
+var easmCommentPrefixes = []string{"//", ";"}
+
+// opcodes with operand which can be a label
+var labeledOpCodes = map[eulvm.OpCode]bool{
+	eulvm.JUMPDEST: true,
+	eulvm.JUMPI:    true,
+	eulvm.CALL:     true,
+}
+
+// EasmError is returned by assembler for invalid easm source
+type EasmError struct {
+	Filepath string
+	Line     int
+	Msg      string
+}
+
+func (err *EasmError) Error() string {
+	return fmt.Sprintf("%s:%d: ERROR %s", err.Filepath, err.Line, err.Msg)
+}
+
+type easmFixup struct {
+	ip    int
+	label string
+	line  int
+}
+
+type assembler struct {
+	filepath string
+	line     int
+
+	instructions []eulvm.Instruction
+	data         []byte
+
+	labels map[string]int
+	fixups []easmFixup
+}
+
+func (a *assembler) errorf(format string, args ...interface{}) error {
+	return &EasmError{
+		Filepath: a.filepath,
+		Line:     a.line,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// AssembleEasm translates easm source into the program. filepath is used only for error messages
+func AssembleEasm(r io.Reader, filepath string) (eulvm.Program, error) {
+	a := &assembler{
+		filepath: filepath,
+		labels:   make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		a.line++
+		if err := a.assembleLine(scanner.Text()); err != nil {
+			return eulvm.Program{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return eulvm.Program{}, err
+	}
+
+	for _, fixup := range a.fixups {
+		addr, ok := a.labels[fixup.label]
+		if !ok {
+			a.line = fixup.line
+			return eulvm.Program{}, a.errorf("label '%s' can't be resolved", fixup.label)
+		}
+		a.instructions[fixup.ip].Operand = *uint256.NewInt(uint64(addr))
+	}
+
+	return eulvm.NewProgram(a.instructions, a.data), nil
+}
+
+// CompileEasmFromFile assembles the easm file. If outputpath isn't empty the program gets dumped into it
+func CompileEasmFromFile(filename string, outputpath string) (eulvm.Program, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return eulvm.Program{}, fmt.Errorf("can't open source file: %w", err)
+	}
+	defer file.Close()
+
+	prog, err := AssembleEasm(file, filename)
+	if err != nil {
+		return eulvm.Program{}, err
+	}
+
+	if outputpath != "" {
+		if err := utils.DumpProgramIntoFile(outputpath, prog); err != nil {
+			return eulvm.Program{}, err
+		}
+	}
+	return prog, nil
+}
+
+func (a *assembler) assembleLine(line string) error {
+	for _, prefix := range easmCommentPrefixes {
+		if idx := strings.Index(line, prefix); idx != -1 {
+			line = line[:idx]
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if strings.HasSuffix(fields[0], labelSfx) {
+		label := strings.TrimSuffix(fields[0], labelSfx)
+		if err := a.defineLabel(label); err != nil {
+			return err
+		}
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return nil
+		}
+	}
+
+	if fields[0] == dataDirective {
+		return a.assembleData(fields[1:])
+	}
+
+	opc, ok := eulvm.OpCodesView[fields[0]]
+	if !ok {
+		return a.errorf("unknown opcode '%s'", fields[0])
+	}
+
+	inst := eulvm.Instruction{OpCode: opc}
+	switch len(fields) {
+	case 1:
+	case 2:
+		operand, ok := parseEasmOperand(fields[1])
+		if ok {
+			inst.Operand = operand
+		} else if labeledOpCodes[opc] && isEasmLabel(fields[1]) {
+			a.fixups = append(a.fixups, easmFixup{
+				ip:    len(a.instructions),
+				label: fields[1],
+				line:  a.line,
+			})
+		} else {
+			return a.errorf("illegal operand '%s' for opcode %s", fields[1], fields[0])
+		}
+	default:
+		return a.errorf("opcode %s expects at most one operand, got %d", fields[0], len(fields)-1)
+	}
+
+	a.instructions = append(a.instructions, inst)
+	return nil
+}
+
+func (a *assembler) defineLabel(label string) error {
+	if !isEasmLabel(label) {
+		return a.errorf("invalid label name '%s'", label)
+	}
+	if _, ok := a.labels[label]; ok {
+		return a.errorf("label '%s' was already defined", label)
+	}
+	a.labels[label] = len(a.instructions)
+	return nil
+}
+
+func (a *assembler) assembleData(args []string) error {
+	if len(args) == 0 {
+		return a.errorf("%s directive expects at least one argument", dataDirective)
+	}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "0x") {
+			return a.errorf("%s argument '%s' must be 0x prefixed hex", dataDirective, arg)
+		}
+		chunk, err := hex.DecodeString(arg[2:])
+		if err != nil {
+			return a.errorf("illegal %s argument '%s': %s", dataDirective, arg, err)
+		}
+		a.data = append(a.data, chunk...)
+	}
+	if len(a.data) > eulvm.MemoryCapacity {
+		return a.errorf("data exceeds memory capacity %d", eulvm.MemoryCapacity)
+	}
+	return nil
+}
+
+// parseEasmOperand parses decimal or 0x prefixed hex number up to 256 bits
+func parseEasmOperand(s string) (eulvm.Word, bool) {
+	var w eulvm.Word
+	if digits, ok := strings.CutPrefix(s, "0x"); ok {
+		if len(digits) == 0 || len(digits) > 64 {
+			return w, false
+		}
+		if len(digits)%2 == 1 {
+			digits = "0" + digits
+		}
+		b, err := hex.DecodeString(digits)
+		if err != nil {
+			return w, false
+		}
+		w.SetBytes(b)
+		return w, true
+	}
+
+	if len(s) == 0 || !isNumber(s[:1]) {
+		return w, false
+	}
+	if err := w.SetFromDecimal(s); err != nil {
+		return w, false
+	}
+	return w, true
+}
+
+func isEasmLabel(s string) bool {
+	if len(s) == 0 || isNumber(s[:1]) {
+		return false
+	}
+	for _, r := range s {
+		if !isName(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,10 +1,15 @@
 package compiler
 
 import (
+	"path/filepath"
+
 	"github.com/Unheilbar/eulang/eulvm"
 )
 
 func CompileFromSource(eulang *eulang, filename string) eulvm.Program {
+	if path, err := filepath.Abs(filename); err == nil {
+		eulang.imports[path] = true
+	}
 	lex := NewLexerFromFile(filename)
 	module := parseEulModule(lex)
 	easm := NewEasm()
@@ -0,0 +1,78 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/Unheilbar/eulang/eulvm"
+)
+
+// amount of preallocated memory bytes per one data directive
+const disasmDataChunk = 32
+
+// opcodes which always print their operand even if it's zero
+var operandOpCodes = map[eulvm.OpCode]bool{
+	eulvm.PUSH:       true,
+	eulvm.SWAP:       true,
+	eulvm.NATIVE:     true,
+	eulvm.MAPVSSTORE: true,
+	eulvm.MAPVSSLOAD: true,
+	eulvm.SIGNEXTEND: true,
+	eulvm.LOG:        true,
+}
+
+// Disassemble writes the program as easm source, which can be assembled back with CompileEasmFromFile.
+// Targets of jumps and calls get generated labels. symbols maps instruction addresses to function names
+// and is used for function entry labels, it can be nil
+func Disassemble(w io.Writer, prog eulvm.Program, symbols map[int]string) error {
+	labels := make(map[int]string)
+	for addr, name := range symbols {
+		labels[addr] = name
+	}
+	for _, inst := range prog.Instrutions {
+		if !labeledOpCodes[inst.OpCode] || !inst.Operand.IsUint64() || inst.Operand.Uint64() >= uint64(len(prog.Instrutions)) {
+			continue
+		}
+		target := int(inst.Operand.Uint64())
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("label_%d", target)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for offset := 0; offset < len(prog.PreallocMemory); offset += disasmDataChunk {
+		end := min(offset+disasmDataChunk, len(prog.PreallocMemory))
+		fmt.Fprintf(bw, "%s 0x%s\n", dataDirective, hex.EncodeToString(prog.PreallocMemory[offset:end]))
+	}
+
+	for ip, inst := range prog.Instrutions {
+		if label, ok := labels[ip]; ok {
+			fmt.Fprintf(bw, "%s%s\n", label, labelSfx)
+		}
+
+		name, ok := eulvm.OpCodes[inst.OpCode]
+		if _, assemblable := eulvm.OpCodesView[name]; !ok || !assemblable {
+			return fmt.Errorf("ip %d: opcode 0x%x can't be disassembled", ip, byte(inst.OpCode))
+		}
+
+		var label string
+		var labeled bool
+		if labeledOpCodes[inst.OpCode] && inst.Operand.IsUint64() {
+			label, labeled = labels[int(inst.Operand.Uint64())]
+		}
+
+		if labeled {
+			fmt.Fprintf(bw, "\t%s %s\n", name, label)
+		} else if !inst.Operand.IsUint64() {
+			fmt.Fprintf(bw, "\t%s %s\n", name, inst.Operand.Hex())
+		} else if !inst.Operand.IsZero() || operandOpCodes[inst.OpCode] {
+			fmt.Fprintf(bw, "\t%s %s\n", name, inst.Operand.Dec())
+		} else {
+			fmt.Fprintf(bw, "\t%s\n", name)
+		}
+	}
+
+	return bw.Flush()
+}
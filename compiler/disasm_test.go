@@ -0,0 +1,35 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DisassembleRoundTrip(t *testing.T) {
+	examples, err := filepath.Glob("../examples/*.eul")
+	assert.NoError(t, err)
+
+	for _, example := range examples {
+		eulang := NewEulang()
+		prog := CompileFromSource(eulang, example)
+
+		var src strings.Builder
+		assert.NoError(t, Disassemble(&src, prog, eulang.Symbols()))
+		for _, name := range eulang.Symbols() {
+			assert.Contains(t, src.String(), "\n"+name+":\n")
+		}
+
+		path := filepath.Join(t.TempDir(), "prog.easm")
+		assert.NoError(t, os.WriteFile(path, []byte(src.String()), 0644))
+
+		assembled, err := CompileEasmFromFile(path, "")
+		assert.NoError(t, err)
+		// easm source doesn't keep source locations
+		prog.SourceMap = nil
+		assert.Equal(t, prog, assembled, example)
+	}
+}
@@ -1,16 +1,74 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Unheilbar/eulang/eulvm"
+	"github.com/Unheilbar/eulang/utils"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_CompileEasmFromFile(t *testing.T) {
-	program := CompileEasmFromFile("../examples/loop.easm", "")
+	output := filepath.Join(t.TempDir(), "loop.o")
+	program, err := CompileEasmFromFile("../examples/loop.easm", output)
+	assert.NoError(t, err)
 
-	for _, inst := range program {
+	for _, inst := range program.Instrutions {
 		fmt.Println(eulvm.OpCodes[inst.OpCode], inst.Operand.Uint64())
 	}
+
+	dumped, err := utils.LoadProgramFromFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, program, dumped)
+
+	_, err = eulvm.New(program).Run(nil, 100_000)
+	assert.NoError(t, err)
+}
+
+func Test_AssembleEasm(t *testing.T) {
+	src := `
+	.data 0x0102 0x03 // preallocated memory
+	start: PUSH 0xff
+		PUSH 115792089237316195423570985008687907853269984665640564039457584007913129639935
+		CALL func ; call by label
+		STOP
+	func:
+		RET
+	`
+	prog, err := AssembleEasm(strings.NewReader(src), "test.easm")
+	assert.NoError(t, err)
+
+	assert.Equal(t, eulvm.NewProgram([]eulvm.Instruction{
+		{OpCode: eulvm.PUSH, Operand: *uint256.NewInt(255)},
+		{OpCode: eulvm.PUSH, Operand: *new(uint256.Int).SetAllOne()},
+		{OpCode: eulvm.CALL, Operand: *uint256.NewInt(4)},
+		{OpCode: eulvm.STOP},
+		{OpCode: eulvm.RET},
+	}, []byte{1, 2, 3}), prog)
+}
+
+func Test_AssembleEasmErrors(t *testing.T) {
+	cases := map[string]int{
+		"PUSH 1\nFOO":                       2,
+		"PUSH 1\nPOP":                       2, // declared but not implemented by the vm
+		"PUSH 1\nPUSH abc":                  2,
+		"a:\nPUSH 1\na:":                    3,
+		"\n\nJUMPI nowhere\n":               3,
+		"PUSH 1 2":                          1,
+		".data 123":                         1,
+		"PUSH 0x" + strings.Repeat("f", 65): 1,
+	}
+
+	for src, line := range cases {
+		_, err := AssembleEasm(strings.NewReader(src), "test.easm")
+		var easmErr *EasmError
+		if assert.True(t, errors.As(err, &easmErr), src) {
+			assert.Equal(t, line, easmErr.Line, src)
+		}
+	}
 }
@@ -3,10 +3,13 @@ package compiler
 import (
 	"fmt"
 	"log"
+	"path/filepath"
+	"slices"
 	"strconv"
 
 	"github.com/Unheilbar/eulang/eulvm"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/holiman/uint256"
 )
 
@@ -25,12 +28,26 @@ type compiledMap struct {
 }
 
 type compiledFunc struct {
+	loc      eulLoc
+	addr     int
+	name     string
+	params   []eulFuncParam
+	returns  eulType
+	modifier eulFuncModifier
+}
+
+type compiledEvent struct {
 	loc    eulLoc
-	addr   int
 	name   string
 	params []eulFuncParam
-	//TODO later extend with arguments and return type info
-	modifier eulFuncModifier
+	topic  common.Hash // keccak of the event signature
+	buf    eulvm.Word  // static memory the args are encoded into before LOG
+}
+
+type compiledContract struct {
+	loc   eulLoc
+	name  string
+	funcs map[string]compiledFunc // external funcs only
 }
 
 type compiledExpr struct {
@@ -83,27 +100,76 @@ var binaryOpByType = map[eulType]map[eulBinaryOpKind]compileOp{
 	eulTypeBytes32: {
 		binaryOpKindEqual:    {eulvm.Instruction{OpCode: eulvm.EQ}, eulTypeBool},
 		binaryOpKindNotEqual: {eulvm.Instruction{OpCode: eulvm.NEQ}, eulTypeBool},
+		binaryOpKindBitAnd:   {eulvm.Instruction{OpCode: eulvm.AND}, eulTypeBytes32},
+		binaryOpKindBitOr:    {eulvm.Instruction{OpCode: eulvm.OR}, eulTypeBytes32},
+		binaryOpKindXor:      {eulvm.Instruction{OpCode: eulvm.XOR}, eulTypeBytes32},
+		binaryOpKindShl:      {eulvm.Instruction{OpCode: eulvm.SHL}, eulTypeBytes32},
+		binaryOpKindShr:      {eulvm.Instruction{OpCode: eulvm.SHR}, eulTypeBytes32},
 	},
 	eulTypei64: {
 		binaryOpKindEqual:    {eulvm.Instruction{OpCode: eulvm.EQ}, eulTypeBool},
 		binaryOpKindNotEqual: {eulvm.Instruction{OpCode: eulvm.NEQ}, eulTypeBool},
-		binaryOpKindLess:     {eulvm.Instruction{OpCode: eulvm.LT}, eulTypeBool},
-		binaryOpKindGreater:  {eulvm.Instruction{OpCode: eulvm.GT}, eulTypeBool},
-		binaryOpKindMulti:    {},
+		binaryOpKindLess:     {eulvm.Instruction{OpCode: eulvm.SLT}, eulTypeBool},
+		binaryOpKindGreater:  {eulvm.Instruction{OpCode: eulvm.SGT}, eulTypeBool},
+		binaryOpKindMulti:    {eulvm.Instruction{OpCode: eulvm.MUL}, eulTypei64},
+		binaryOpKindDiv:      {eulvm.Instruction{OpCode: eulvm.SDIV}, eulTypei64},
+		binaryOpKindMod:      {eulvm.Instruction{OpCode: eulvm.SMOD}, eulTypei64},
 		binaryOpKindPlus:     {eulvm.Instruction{OpCode: eulvm.ADD}, eulTypei64},
 		binaryOpKindMinus:    {eulvm.Instruction{OpCode: eulvm.SUB}, eulTypei64},
+		binaryOpKindBitAnd:   {eulvm.Instruction{OpCode: eulvm.AND}, eulTypei64},
+		binaryOpKindBitOr:    {eulvm.Instruction{OpCode: eulvm.OR}, eulTypei64},
+		binaryOpKindXor:      {eulvm.Instruction{OpCode: eulvm.XOR}, eulTypei64},
+		binaryOpKindShl:      {eulvm.Instruction{OpCode: eulvm.SHL}, eulTypei64},
+		binaryOpKindShr:      {eulvm.Instruction{OpCode: eulvm.SAR}, eulTypei64},
 	},
 }
 
+// shift amount is always i64 whatever type is shifted
+var shiftOps = map[eulBinaryOpKind]bool{
+	binaryOpKindShl: true,
+	binaryOpKindShr: true,
+}
+
+var unaryOpByType = map[eulType]map[eulUnaryOpKind]eulType{
+	eulTypei64: {
+		unaryOpKindMinus:  eulTypei64,
+		unaryOpKindBitNot: eulTypei64,
+	},
+	eulTypeBytes32: {
+		unaryOpKindBitNot: eulTypeBytes32,
+	},
+}
+
+// i64 values live on the stack as sign extended 256 bit words.
+// Results of i64 arithmetic get sign extended from this byte so they overflow like go int64
+var i64SignByte = *uint256.NewInt(7)
+
+// i64Word converts int64 into sign extended word
+func i64Word(v int64) uint256.Int {
+	var w uint256.Int
+	w.SetUint64(uint64(v))
+	return *w.ExtendSign(&w, &i64SignByte)
+}
+
 // eulang stores all the context of 0euler compiler (compiled functions, scopes, etc.)
 type eulang struct {
-	funcs map[string]compiledFunc
-	maps  map[string]compiledMap
+	funcs   map[string]compiledFunc
+	maps    map[string]compiledMap
+	externs map[string]nativeFunc
+	events  map[string]compiledEvent
+
+	contracts map[string]compiledContract
+	imports   map[string]bool // files being compiled, contracts can't import each other in a circle
+
+	natives *eulvm.NativeRegistry // host natives extern funcs are checked against
 
 	scope *eulScope
+	fn    *compiledFunc // function which is being compiled
 
 	stackFrameAddr uint256.Int
 	frameSize      uint64
+
+	returnBuf *uint256.Int // static word external funcs put their result into before RETURN
 }
 
 func NewEulang() *eulang {
@@ -111,11 +177,23 @@ func NewEulang() *eulang {
 		scope: &eulScope{
 			compiledVars: make(map[string]compiledVar),
 		},
-		funcs: make(map[string]compiledFunc),
-		maps:  make(map[string]compiledMap),
+		funcs:   make(map[string]compiledFunc),
+		maps:    make(map[string]compiledMap),
+		externs: make(map[string]nativeFunc),
+		events:  make(map[string]compiledEvent),
+
+		contracts: make(map[string]compiledContract),
+		imports:   make(map[string]bool),
 	}
 }
 
+// WithNatives sets host natives registry. Extern funcs must be registered in it with the same signature.
+// Without registry extern declarations are trusted and checked by the vm verifier only
+func (e *eulang) WithNatives(natives *eulvm.NativeRegistry) *eulang {
+	e.natives = natives
+	return e
+}
+
 func (e *eulang) compileModuleIntoEasm(easm *easm, module eulModule) {
 	for _, top := range module.tops {
 		switch top.kind {
@@ -125,12 +203,137 @@ func (e *eulang) compileModuleIntoEasm(easm *easm, module eulModule) {
 			e.compileVarDefIntoEasm(easm, top.as.vdef, storageKindStatic)
 		case eulTopKindMap:
 			e.addMapDef(top.as.mdef)
+		case eulTopKindExtern:
+			e.addExternDef(top.as.edef)
+		case eulTopKindEvent:
+			e.compileEventDefIntoEasm(easm, top.as.evdef)
+		case eulTopKindContract:
+			e.addContractDef(top.as.cdef)
 		default:
 			panic("try to compile unexpected top kind")
 		}
 	}
 }
 
+var nativeTypes = map[eulType]eulvm.NativeType{
+	eulTypeVoid:    eulvm.NativeVoid,
+	eulTypei64:     eulvm.NativeI64,
+	eulTypeBool:    eulvm.NativeBool,
+	eulTypeBytes32: eulvm.NativeBytes32,
+	eulTypeAddress: eulvm.NativeAddress,
+}
+
+func (e *eulang) addExternDef(edef eulExternDef) {
+	if e.funcNameTaken(edef.name) {
+		log.Fatalf("%s:%d:%d ERROR double declaration. func '%s' was already defined",
+			edef.loc.filepath, edef.loc.row, edef.loc.col, edef.name)
+	}
+
+	sig := eulvm.NativeSignature{Returns: nativeTypes[edef.returns]}
+	native := nativeFunc{
+		id:      eulvm.HostNativeID(edef.name),
+		returns: edef.returns,
+	}
+	for _, param := range edef.params {
+		if param.typee == eulTypeVoid {
+			log.Fatalf("%s:%d:%d ERROR extern func param '%s' can't be void",
+				param.loc.filepath, param.loc.row, param.loc.col, param.name)
+		}
+		native.params = append(native.params, param.typee)
+		sig.Params = append(sig.Params, nativeTypes[param.typee])
+	}
+
+	if e.natives != nil {
+		registered, ok := e.natives.Lookup(edef.name)
+		if !ok {
+			log.Fatalf("%s:%d:%d ERROR extern func '%s' isn't registered by host",
+				edef.loc.filepath, edef.loc.row, edef.loc.col, edef.name)
+		}
+		if registered.Sig.Returns != sig.Returns || !slices.Equal(registered.Sig.Params, sig.Params) {
+			log.Fatalf("%s:%d:%d ERROR extern func '%s' signature '%s' doesn't match registered '%s'",
+				edef.loc.filepath, edef.loc.row, edef.loc.col, edef.name, sig, registered.Sig)
+		}
+	}
+
+	e.externs[edef.name] = native
+}
+
+func (e *eulang) compileEventDefIntoEasm(easm *easm, evdef eulEventDef) {
+	if _, ok := e.events[evdef.name]; ok {
+		log.Fatalf("%s:%d:%d ERROR double declaration. event '%s' was already defined",
+			evdef.loc.filepath, evdef.loc.row, evdef.loc.col, evdef.name)
+	}
+
+	sig := evdef.name + "("
+	for i, param := range evdef.params {
+		if param.typee == eulTypeVoid {
+			log.Fatalf("%s:%d:%d ERROR event param '%s' can't be void",
+				param.loc.filepath, param.loc.row, param.loc.col, param.name)
+		}
+		if i > 0 {
+			sig += ","
+		}
+		sig += eulTypes[param.typee]
+	}
+	sig += ")"
+
+	e.events[evdef.name] = compiledEvent{
+		loc:    evdef.loc,
+		name:   evdef.name,
+		params: evdef.params,
+		topic:  crypto.Keccak256Hash([]byte(sig)),
+		buf:    easm.pushByteArrToMemory(make([]byte, len(evdef.params)*int(eulvm.WordLength.Uint64()))),
+	}
+}
+
+// funcNameTaken checks if the name is used by builtin, extern or compiled function
+func (e *eulang) funcNameTaken(name string) bool {
+	_, isFunc := e.funcs[name]
+	_, isExtern := e.externs[name]
+	_, isHash := hashNatives[name]
+	_, isBuiltin := builtinNatives[name]
+	_, isCheck := checkBuiltins[name]
+	_, isContract := e.contracts[name]
+	return isFunc || isExtern || isHash || isBuiltin || isCheck || isContract || name == "write" || name == "writef"
+}
+
+// addContractDef compiles source of the contract to learn its external funcs.
+// Method selectors are addresses of the funcs, so the contract must be deployed from the same source
+func (e *eulang) addContractDef(cdef eulContractDef) {
+	if e.funcNameTaken(cdef.name) {
+		log.Fatalf("%s:%d:%d ERROR double declaration. contract '%s' was already defined",
+			cdef.loc.filepath, cdef.loc.row, cdef.loc.col, cdef.name)
+	}
+
+	path, err := filepath.Abs(filepath.Join(filepath.Dir(cdef.loc.filepath), cdef.path))
+	if err != nil {
+		log.Fatalf("%s:%d:%d ERROR invalid contract path '%s': %s",
+			cdef.loc.filepath, cdef.loc.row, cdef.loc.col, cdef.path, err)
+	}
+	if e.imports[path] {
+		log.Fatalf("%s:%d:%d ERROR circular import of contract '%s'",
+			cdef.loc.filepath, cdef.loc.row, cdef.loc.col, cdef.name)
+	}
+
+	imported := NewEulang().WithNatives(e.natives)
+	for file := range e.imports {
+		imported.imports[file] = true
+	}
+	CompileFromSource(imported, path)
+
+	contract := compiledContract{
+		loc:   cdef.loc,
+		name:  cdef.name,
+		funcs: make(map[string]compiledFunc),
+	}
+	for name, f := range imported.funcs {
+		if f.modifier == eulModifierKindExternal {
+			contract.funcs[name] = f
+		}
+	}
+	e.contracts[cdef.name] = contract
+}
+
 func (e *eulang) addMapDef(mdef eulMapDef) {
 	// TODO validate key and value types. Only few types are available for usage as map keys/values
 	compMap, ok := e.maps[mdef.name]
@@ -195,7 +398,7 @@ func (e *eulang) compileVarIntoEasm(easm *easm, vd eulVarDef, storage varStorage
 
 func (e *eulang) compileFuncDefIntoEasm(easm *easm, fd eulFuncDef) {
 	var f compiledFunc
-	if _, ok := e.funcs[fd.name]; ok {
+	if e.funcNameTaken(fd.name) {
 		log.Fatalf("%s:%d:%d ERROR double declaration. func '%s' was already defined",
 			fd.loc.filepath, fd.loc.row, fd.loc.col, fd.name)
 	}
@@ -203,10 +406,18 @@ func (e *eulang) compileFuncDefIntoEasm(easm *easm, fd eulFuncDef) {
 	f.name = fd.name
 	f.loc = fd.loc
 	f.params = fd.params
-	e.funcs[f.name] = f
+	f.returns = fd.returns
 	f.modifier = fd.modifier
+	e.funcs[f.name] = f
+	e.fn = &f
+	defer e.locate(easm, fd.loc)()
 	e.pushNewScope()
 
+	if f.returns != eulTypeVoid && !blockReturns(&fd.body) {
+		log.Fatalf("%s:%d:%d ERROR missing return at the end of func '%s'",
+			fd.loc.filepath, fd.loc.row, fd.loc.col, fd.name)
+	}
+
 	// compile func params
 	if fd.modifier == eulModifierKindExternal && len(fd.params) != 0 {
 		e.compileExternalFuncParams(easm, fd.params)
@@ -216,7 +427,12 @@ func (e *eulang) compileFuncDefIntoEasm(easm *easm, fd eulFuncDef) {
 
 	e.compileBlockIntoEasm(easm, &fd.body)
 	e.popScope()
+	e.fn = nil
 
+	// NOTE we don't emit unreachable code, the verifier would take it for a separate function
+	if blockReturns(&fd.body) {
+		return
+	}
 	if fd.modifier != eulModifierKindExternal {
 		easm.pushInstruction(eulvm.Instruction{
 			OpCode: eulvm.RET},
@@ -270,6 +486,7 @@ func (e *eulang) compileInternalFuncParams(easm *easm, params []eulFuncParam) {
 }
 
 func (e *eulang) compileStatementIntoEasm(easm *easm, stmt eulStatement) {
+	defer e.locate(easm, stmt.loc())()
 	switch stmt.kind {
 	case eulStmtKindExpr:
 		expr := e.compileExprIntoEasm(easm, stmt.as.expr)
@@ -290,11 +507,182 @@ func (e *eulang) compileStatementIntoEasm(easm *easm, stmt eulStatement) {
 		e.compileVarDefIntoEasm(easm, stmt.as.vardef, storageKindStack)
 	case eulStmtKindMapWrite:
 		e.compileMapWriteIntoEasm(easm, stmt.as.mapWrite)
+	case eulStmtKindReturn:
+		e.compileReturnIntoEasm(easm, stmt.as.ret)
+	case eulStmtKindEmit:
+		e.compileEmitIntoEasm(easm, stmt.as.emit)
 	default:
 		panic(fmt.Sprintf("stmt kind doesn't exist kind %d", stmt.kind))
 	}
 }
 
+// locate makes easm record the location for next instructions. It returns the func restoring the previous one
+func (e *eulang) locate(easm *easm, loc eulLoc) func() {
+	prev := easm.loc
+	easm.loc = eulvm.SourceLoc{
+		File: loc.filepath,
+		Row:  loc.row,
+		Col:  loc.col,
+	}
+	if e.fn != nil {
+		easm.loc.Func = e.fn.name
+	}
+	return func() {
+		easm.loc = prev
+	}
+}
+
+// compileReturnIntoEasm leaves the function. Return address is on top of the stack at statements level,
+// so the value goes under it before RET. External funcs hand their value to the host with RETURN instead
+func (e *eulang) compileReturnIntoEasm(easm *easm, ret eulReturn) {
+	if !ret.hasValue {
+		if e.fn.returns != eulTypeVoid {
+			log.Fatalf("%s:%d:%d ERROR func '%s' must return value of type '%s'",
+				ret.loc.filepath, ret.loc.row, ret.loc.col, e.fn.name, eulTypes[e.fn.returns])
+		}
+		if e.fn.modifier == eulModifierKindExternal {
+			easm.pushInstruction(eulvm.Instruction{
+				OpCode: eulvm.STOP,
+			})
+		} else {
+			easm.pushInstruction(eulvm.Instruction{
+				OpCode: eulvm.RET,
+			})
+		}
+		return
+	}
+
+	if e.fn.modifier == eulModifierKindExternal {
+		e.compileExternalReturnIntoEasm(easm, ret)
+		return
+	}
+
+	val := e.compileExprIntoEasm(easm, ret.value)
+	e.checkReturnType(ret, val)
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.SWAP,
+		Operand: *uint256.NewInt(1),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.RET,
+	})
+}
+
+// compileExternalReturnIntoEasm ABI encodes the value into the return buffer and returns it to the host.
+// Every eulang type is encoded as a single 32 bytes word the same way it's kept on the stack
+// (i64 is sign extended two's complement, bool is 0 or 1, address is left padded with zeroes)
+func (e *eulang) compileExternalReturnIntoEasm(easm *easm, ret eulReturn) {
+	if e.returnBuf == nil {
+		buf := easm.pushByteArrToMemory(make([]byte, eulvm.WordLength.Uint64()))
+		e.returnBuf = &buf
+	}
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *e.returnBuf,
+	})
+	val := e.compileExprIntoEasm(easm, ret.value)
+	e.checkReturnType(ret, val)
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.MSTORE256,
+	})
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *e.returnBuf,
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: eulvm.WordLength,
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.RETURN,
+	})
+}
+
+func (e *eulang) checkReturnType(ret eulReturn, val compiledExpr) {
+	if val.typee != e.fn.returns {
+		log.Fatalf("%s:%d:%d ERROR func '%s' returns '%s' but got '%s'",
+			ret.loc.filepath, ret.loc.row, ret.loc.col, e.fn.name, eulTypes[e.fn.returns], eulTypes[val.typee])
+	}
+}
+
+// compileEmitIntoEasm encodes args into the event buffer word by word the same way external funcs return values
+// and emits the log with the event signature hash as the only topic
+func (e *eulang) compileEmitIntoEasm(easm *easm, emit eulEmit) {
+	call := emit.call
+	event, ok := e.events[call.name]
+	if !ok {
+		log.Fatalf("%s:%d:%d ERROR emit of undeclared event '%s'",
+			call.loc.filepath, call.loc.row, call.loc.col, call.name)
+	}
+	if len(call.args) != len(event.params) {
+		log.Fatalf("%s:%d:%d ERROR event '%s' arity missmatch. Expected '%d' arguments but got '%d' instead ",
+			call.loc.filepath, call.loc.row, call.loc.col, call.name, len(event.params), len(call.args))
+	}
+
+	// args are evaluated before any of them is stored, nested emits of the same event share the buffer
+	for i := len(call.args) - 1; i >= 0; i-- {
+		arg := call.args[i].value
+		if arg.kind == eulExprKindStrLit {
+			log.Fatalf("%s:%d:%d ERROR strings can't be emitted",
+				arg.loc.filepath, arg.loc.row, arg.loc.col)
+		}
+		compiled := e.compileExprIntoEasm(easm, arg)
+		if compiled.typee != event.params[i].typee {
+			log.Fatalf("%s:%d:%d ERROR event '%s' argument %d expects type '%s' but got '%s'",
+				arg.loc.filepath, arg.loc.row, arg.loc.col, call.name, i+1, eulTypes[event.params[i].typee], eulTypes[compiled.typee])
+		}
+	}
+	for i := range call.args {
+		var addr eulvm.Word
+		addr.AddUint64(&event.buf, uint64(i)*eulvm.WordLength.Uint64())
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.PUSH,
+			Operand: addr,
+		})
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.SWAP,
+			Operand: *uint256.NewInt(1),
+		})
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.MSTORE256,
+		})
+	}
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *new(uint256.Int).SetBytes32(event.topic[:]),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: event.buf,
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *uint256.NewInt(uint64(len(event.params)) * eulvm.WordLength.Uint64()),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.LOG,
+		Operand: *uint256.NewInt(1),
+	})
+}
+
+// blockReturns checks that the block always ends with return
+func blockReturns(block *eulBlock) bool {
+	if block == nil || len(block.statements) == 0 {
+		return false
+	}
+	last := block.statements[len(block.statements)-1]
+	switch last.kind {
+	case eulStmtKindReturn:
+		return true
+	case eulStmtKindIf:
+		return blockReturns(last.as.eif.ethen) && blockReturns(last.as.eif.elze)
+	}
+	return false
+}
+
 func (e *eulang) compileWhileIntoEasm(easm *easm, w eulWhile) {
 	condExpr := e.compileExprIntoEasm(easm, w.condition)
 	//TODO later make something like (checkCondExpression cause it seems like reusable)
@@ -314,10 +702,12 @@ func (e *eulang) compileWhileIntoEasm(easm *easm, w eulWhile) {
 	e.pushNewScope()
 	e.compileBlockIntoEasm(easm, &w.body)
 	e.popScope()
-	easm.PushInstruction(eulvm.Instruction{
-		OpCode:  eulvm.JUMPDEST,
-		Operand: *uint256.NewInt(uint64(condExpr.addr)),
-	})
+	if !blockReturns(&w.body) {
+		easm.PushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.JUMPDEST,
+			Operand: *uint256.NewInt(uint64(condExpr.addr)),
+		})
+	}
 	bodyEnd := easm.program.Size()
 
 	// resolve deferred
@@ -335,7 +725,8 @@ func (e *eulang) compileVarAssignIntoEasm(easm *easm, expr eulVarAssign) {
 	e.compileGetVarAddr(easm, vari)
 
 	// TODO maybe refactor its later
-	if vari.etype == eulTypeBytes32 {
+	// string literals are hex representations of bytes32 and address values
+	if vari.etype == eulTypeBytes32 && expr.value.kind == eulExprKindStrLit {
 		expr.value.kind = eulExprKindBytes32Lit
 		expr.value.as.bytes32Lit = common.HexToHash(expr.value.as.strLit)
 		if expr.value.as.bytes32Lit.Hex() != expr.value.as.strLit {
@@ -343,7 +734,7 @@ func (e *eulang) compileVarAssignIntoEasm(easm *easm, expr eulVarAssign) {
 				expr.loc.filepath, expr.loc.row, expr.loc.col, expr.value.as.strLit)
 		}
 	}
-	if vari.etype == eulTypeAddress {
+	if vari.etype == eulTypeAddress && expr.value.kind == eulExprKindStrLit {
 		expr.value.kind = eulExprKindAddressLit
 		expr.value.as.addressLit = common.HexToAddress(expr.value.as.strLit)
 		if !common.IsHexAddress(expr.value.as.strLit) {
@@ -402,7 +793,12 @@ func (e *eulang) compileBinaryOpIntoEasm(easm *easm, binOp binaryOp) eulType {
 	lhsCompiled := e.compileExprIntoEasm(easm, binOp.lhs)
 	rhsCompiled := e.compileExprIntoEasm(easm, binOp.rhs)
 
-	if rhsCompiled.typee != lhsCompiled.typee {
+	if shiftOps[binOp.kind] {
+		if rhsCompiled.typee != eulTypei64 {
+			log.Fatalf("%s:%d:%d ERROR shift amount must be '%s' but got '%s'",
+				binOp.loc.filepath, binOp.loc.row, binOp.loc.col, eulTypes[eulTypei64], eulTypes[rhsCompiled.typee])
+		}
+	} else if rhsCompiled.typee != lhsCompiled.typee {
 		log.Fatalf("%s:%d:%d ERROR expression types on left and right side do not match '%s' != '%s'",
 			binOp.loc.filepath, binOp.loc.row, binOp.loc.col, eulTypes[lhsCompiled.typee], eulTypes[rhsCompiled.typee])
 	}
@@ -417,10 +813,51 @@ func (e *eulang) compileBinaryOpIntoEasm(easm *easm, binOp binaryOp) eulType {
 	}
 
 	easm.pushInstruction(bOp.instruction)
+	if bOp.returns == eulTypei64 {
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.SIGNEXTEND,
+			Operand: i64SignByte,
+		})
+	}
 
 	return bOp.returns
 }
 
+func (e *eulang) compileUnaryOpIntoEasm(easm *easm, unOp unaryOp) eulType {
+	if unOp.kind == unaryOpKindMinus {
+		// -x is compiled as 0 - x
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.PUSH,
+		})
+	}
+
+	operand := e.compileExprIntoEasm(easm, unOp.operand)
+	returns, ok := unaryOpByType[operand.typee][unOp.kind]
+	if !ok {
+		log.Fatalf("%s:%d:%d ERROR impossible unary operation for type '%s'",
+			unOp.loc.filepath, unOp.loc.row, unOp.loc.col, eulTypes[operand.typee])
+	}
+
+	switch unOp.kind {
+	case unaryOpKindMinus:
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.SUB,
+		})
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.SIGNEXTEND,
+			Operand: i64SignByte,
+		})
+	case unaryOpKindBitNot:
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.BNOT,
+		})
+	default:
+		panic("unsupported unary operation kind")
+	}
+
+	return returns
+}
+
 func (e *eulang) compileVarReadIntoEasm(easm *easm, expr varRead) eulType {
 	cvar := e.getCompiledVarByName(expr.name)
 
@@ -450,6 +887,101 @@ func (e *eulang) compileVarReadIntoEasm(easm *easm, expr varRead) eulType {
 	return cvar.etype
 }
 
+// compileExtCallIntoEasm encodes the input of the method into static buffer and calls the contract with EXTCALL.
+// Args are evaluated on the stack before they're stored, so calls nested in args don't overwrite the buffer
+func (e *eulang) compileExtCallIntoEasm(easm *easm, call extCall) eulType {
+	contract, ok := e.contracts[call.contract]
+	if !ok {
+		log.Fatalf("%s:%d:%d ERROR undefined contract '%s'",
+			call.loc.filepath, call.loc.row, call.loc.col, call.contract)
+	}
+	method, ok := contract.funcs[call.method.name]
+	if !ok {
+		log.Fatalf("%s:%d:%d ERROR contract '%s' has no external func '%s'",
+			call.method.loc.filepath, call.method.loc.row, call.method.loc.col, call.contract, call.method.name)
+	}
+	args := call.method.args
+	if len(args) != len(method.params) {
+		log.Fatalf("%s:%d:%d ERROR funcall arity missmatch. Expected '%d' arguments but got '%d' instead ",
+			call.method.loc.filepath, call.method.loc.row, call.method.loc.col, len(method.params), len(args))
+	}
+
+	if target := e.compileExprIntoEasm(easm, call.target); target.typee != eulTypeAddress {
+		log.Fatalf("%s:%d:%d ERROR contract '%s' expects address but got '%s'",
+			call.target.loc.filepath, call.target.loc.row, call.target.loc.col, call.contract, eulTypes[target.typee])
+	}
+
+	for i := len(args) - 1; i >= 0; i-- {
+		arg := args[i].value
+		if arg.kind == eulExprKindStrLit {
+			log.Fatalf("%s:%d:%d ERROR strings can't be passed to other contracts",
+				arg.loc.filepath, arg.loc.row, arg.loc.col)
+		}
+		compiled := e.compileExprIntoEasm(easm, arg)
+		if compiled.typee != method.params[i].typee {
+			log.Fatalf("%s:%d:%d ERROR funcall type missmatch. Expected '%s' type but got '%s' instead ",
+				arg.loc.filepath, arg.loc.row, arg.loc.col, eulTypes[method.params[i].typee], eulTypes[compiled.typee])
+		}
+	}
+
+	// the first word of the input is the method selector
+	buf := easm.pushWordToMemory(*uint256.NewInt(uint64(method.addr)))
+	easm.pushByteArrToMemory(make([]byte, len(args)*int(eulvm.WordLength.Uint64())))
+	for i := range args {
+		var addr eulvm.Word
+		addr.AddUint64(&buf, uint64(i+1)*eulvm.WordLength.Uint64())
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.PUSH,
+			Operand: addr,
+		})
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode:  eulvm.SWAP,
+			Operand: *uint256.NewInt(1),
+		})
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.MSTORE256,
+		})
+	}
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: buf,
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *uint256.NewInt(uint64(len(args)+1) * eulvm.WordLength.Uint64()),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.EXTCALL,
+	})
+
+	if method.returns == eulTypeVoid {
+		easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.DROP,
+		})
+	}
+	return method.returns
+}
+
+// contextFields are builtin execution context values
+var contextFields = map[string]compileOp{
+	"msg.sender":      {eulvm.Instruction{OpCode: eulvm.CALLER}, eulTypeAddress},
+	"tx.origin":       {eulvm.Instruction{OpCode: eulvm.ORIGIN}, eulTypeAddress},
+	"block.number":    {eulvm.Instruction{OpCode: eulvm.NUMBER}, eulTypei64},
+	"block.timestamp": {eulvm.Instruction{OpCode: eulvm.TIMESTAMP}, eulTypei64},
+	"block.chainid":   {eulvm.Instruction{OpCode: eulvm.CHAINID}, eulTypei64},
+}
+
+func (e *eulang) compileContextReadIntoEasm(easm *easm, cr contextRead) eulType {
+	field, ok := contextFields[cr.name]
+	if !ok {
+		log.Fatalf("%s:%d:%d ERROR unknown builtin '%s'",
+			cr.loc.filepath, cr.loc.row, cr.loc.col, cr.name)
+	}
+	easm.pushInstruction(field.instruction)
+	return field.returns
+}
+
 func (e *eulang) compileMapReadIntoEasm(easm *easm, expr mapRead) eulType {
 	// TODO for now all maps are in global scope
 	mread, ok := e.maps[expr.name]
@@ -496,9 +1028,12 @@ func (e *eulang) compileIfIntoEasm(easm *easm, eif eulIf) {
 	e.pushNewScope()
 	e.compileBlockIntoEasm(easm, eif.ethen)
 	e.popScope()
-	jmpElseAddr := easm.pushInstruction(eulvm.Instruction{
-		OpCode: eulvm.JUMPDEST,
-	})
+	jmpElseAddr := -1
+	if !blockReturns(eif.ethen) {
+		jmpElseAddr = easm.pushInstruction(eulvm.Instruction{
+			OpCode: eulvm.JUMPDEST,
+		})
+	}
 	elseAddr := easm.program.Size()
 	e.pushNewScope()
 	e.compileBlockIntoEasm(easm, eif.elze)
@@ -506,7 +1041,9 @@ func (e *eulang) compileIfIntoEasm(easm *easm, eif eulIf) {
 	endAddr := easm.program.Size()
 
 	easm.program.Instrutions[jmpThenAddr].Operand = *uint256.NewInt(uint64(elseAddr))
-	easm.program.Instrutions[jmpElseAddr].Operand = *uint256.NewInt(uint64(endAddr))
+	if jmpElseAddr != -1 {
+		easm.program.Instrutions[jmpElseAddr].Operand = *uint256.NewInt(uint64(endAddr))
+	}
 }
 
 // returns address of the end of the block
@@ -514,7 +1051,11 @@ func (e *eulang) compileBlockIntoEasm(easm *easm, block *eulBlock) int {
 	if block == nil {
 		return easm.program.Size()
 	}
-	for _, stmt := range block.statements {
+	for i, stmt := range block.statements {
+		if i > 0 && block.statements[i-1].kind == eulStmtKindReturn {
+			loc := block.statements[i-1].as.ret.loc
+			log.Fatalf("%s:%d:%d ERROR unreachable code after return", loc.filepath, loc.row, loc.col)
+		}
 		e.compileStatementIntoEasm(easm, stmt)
 	}
 
@@ -525,6 +1066,7 @@ func (e *eulang) compileExprIntoEasm(easm *easm, expr eulExpr) compiledExpr {
 	var cExp compiledExpr
 	cExp.addr = easm.program.Size()
 	cExp.loc = expr.loc
+	defer e.locate(easm, expr.loc)()
 	switch expr.kind {
 	case eulExprKindFuncCall:
 		// TODO temporary solution hard code just one function
@@ -534,10 +1076,20 @@ func (e *eulang) compileExprIntoEasm(easm *easm, expr eulExpr) compiledExpr {
 		} else if expr.as.funcCall.name == "writef" {
 			e.compileNativeWriteFIntoEasm(easm, expr.as.funcCall)
 			cExp.typee = eulTypeVoid
-		} else {
-			e.compileFuncCallIntoEasm(easm, expr.as.funcCall)
-			// TODO we don't support return types yet
+		} else if _, ok := checkBuiltins[expr.as.funcCall.name]; ok {
+			e.compileCheckIntoEasm(easm, expr.as.funcCall)
 			cExp.typee = eulTypeVoid
+		} else if natives, ok := hashNatives[expr.as.funcCall.name]; ok {
+			e.compileNativeHashIntoEasm(easm, expr.as.funcCall, natives)
+			cExp.typee = eulTypeBytes32
+		} else if native, ok := builtinNatives[expr.as.funcCall.name]; ok {
+			e.compileNativeCallIntoEasm(easm, expr.as.funcCall, native)
+			cExp.typee = native.returns
+		} else if native, ok := e.externs[expr.as.funcCall.name]; ok {
+			e.compileNativeCallIntoEasm(easm, expr.as.funcCall, native)
+			cExp.typee = native.returns
+		} else {
+			cExp.typee = e.compileFuncCallIntoEasm(easm, expr.as.funcCall)
 		}
 	case eulExprKindStrLit:
 		var addr eulvm.Word = easm.pushStringToMemory(expr.as.strLit)
@@ -574,7 +1126,7 @@ func (e *eulang) compileExprIntoEasm(easm *easm, expr eulExpr) compiledExpr {
 	case eulExprKindIntLit:
 		easm.pushInstruction(eulvm.Instruction{
 			OpCode:  eulvm.PUSH,
-			Operand: *uint256.NewInt(uint64(expr.as.intLit)),
+			Operand: i64Word(expr.as.intLit),
 		})
 		cExp.typee = eulTypei64
 	case eulExprKindBoolLit:
@@ -594,8 +1146,14 @@ func (e *eulang) compileExprIntoEasm(easm *easm, expr eulExpr) compiledExpr {
 		cExp.typee = e.compileVarReadIntoEasm(easm, expr.as.varRead)
 	case eulExprKindBinaryOp:
 		cExp.typee = e.compileBinaryOpIntoEasm(easm, *expr.as.binaryOp)
+	case eulExprKindUnaryOp:
+		cExp.typee = e.compileUnaryOpIntoEasm(easm, *expr.as.unaryOp)
 	case eulExprKindMapRead:
 		cExp.typee = e.compileMapReadIntoEasm(easm, *expr.as.mapRead)
+	case eulExprKindContextRead:
+		cExp.typee = e.compileContextReadIntoEasm(easm, expr.as.ctxRead)
+	case eulExprKindExtCall:
+		cExp.typee = e.compileExtCallIntoEasm(easm, *expr.as.extCall)
 	default:
 		panic("unsupported expression kind")
 	}
@@ -617,6 +1175,118 @@ func (e *eulang) compileNativeWriteFIntoEasm(easm *easm, funcCall eulFuncCall) {
 	})
 }
 
+// nativeFunc describes native function with fixed signature. Args are pushed in order, so the last one is on top
+type nativeFunc struct {
+	id      uint64
+	params  []eulType
+	returns eulType
+}
+
+var builtinNatives = map[string]nativeFunc{
+	"ecrecover": {
+		id:      eulvm.NativeEcrecover,
+		params:  []eulType{eulTypeBytes32, eulTypei64, eulTypeBytes32, eulTypeBytes32},
+		returns: eulTypeAddress,
+	},
+}
+
+func (e *eulang) compileNativeCallIntoEasm(easm *easm, funcCall eulFuncCall, native nativeFunc) {
+	if len(funcCall.args) != len(native.params) {
+		log.Fatalf("%s:%d:%d ERROR funcall arity missmatch. Expected '%d' arguments but got '%d' instead ",
+			funcCall.loc.filepath, funcCall.loc.row, funcCall.loc.col, len(native.params), len(funcCall.args))
+	}
+
+	for i, arg := range funcCall.args {
+		compiled := e.compileExprIntoEasm(easm, arg.value)
+		if compiled.typee != native.params[i] {
+			log.Fatalf("%s:%d:%d ERROR '%s' argument %d expects type '%s' but got '%s'",
+				arg.value.loc.filepath, arg.value.loc.row, arg.value.loc.col, funcCall.name, i+1, eulTypes[native.params[i]], eulTypes[compiled.typee])
+		}
+	}
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.NATIVE,
+		Operand: *uint256.NewInt(native.id),
+	})
+}
+
+// check builtins revert the run if the condition is false. require takes reason string as the second argument
+var checkBuiltins = map[string]int{
+	"require": 2,
+	"assert":  1,
+}
+
+// reason of failed assert
+const assertReason = "assertion failed"
+
+func (e *eulang) compileCheckIntoEasm(easm *easm, funcCall eulFuncCall) {
+	argc := checkBuiltins[funcCall.name]
+	if len(funcCall.args) != argc {
+		log.Fatalf("%s:%d:%d ERROR '%s' expects '%d' arguments but got '%d'",
+			funcCall.loc.filepath, funcCall.loc.row, funcCall.loc.col, funcCall.name, argc, len(funcCall.args))
+	}
+
+	cond := funcCall.args[0].value
+	if compiled := e.compileExprIntoEasm(easm, cond); compiled.typee != eulTypeBool {
+		log.Fatalf("%s:%d:%d ERROR '%s' condition should be boolean, got %s",
+			cond.loc.filepath, cond.loc.row, cond.loc.col, funcCall.name, eulTypes[compiled.typee])
+	}
+
+	reason := assertReason
+	if argc == 2 {
+		arg := funcCall.args[1].value
+		if arg.kind != eulExprKindStrLit {
+			log.Fatalf("%s:%d:%d ERROR '%s' reason should be string literal",
+				arg.loc.filepath, arg.loc.row, arg.loc.col, funcCall.name)
+		}
+		reason = arg.as.strLit
+	}
+
+	jmpOkAddr := easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.JUMPI,
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: easm.pushStringToMemory(reason),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.PUSH,
+		Operand: *uint256.NewInt(uint64(len(reason))),
+	})
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode: eulvm.REVERT,
+	})
+	easm.program.Instrutions[jmpOkAddr].Operand = *uint256.NewInt(uint64(easm.program.Size()))
+}
+
+// hash builtins natives. First one hashes 32 bytes word, second one hashes string
+var hashNatives = map[string][2]uint64{
+	"keccak256": {eulvm.NativeKeccak256, eulvm.NativeKeccak256Str},
+	"sha256":    {eulvm.NativeSha256, eulvm.NativeSha256Str},
+}
+
+func (e *eulang) compileNativeHashIntoEasm(easm *easm, funcCall eulFuncCall, natives [2]uint64) {
+	if len(funcCall.args) != 1 {
+		log.Fatalf("%s:%d:%d ERROR '%s' expects exactly one argument but got '%d'",
+			funcCall.loc.filepath, funcCall.loc.row, funcCall.loc.col, funcCall.name, len(funcCall.args))
+	}
+
+	arg := funcCall.args[0].value
+	native := natives[0]
+	compiled := e.compileExprIntoEasm(easm, arg)
+	if arg.kind == eulExprKindStrLit {
+		native = natives[1]
+	} else if compiled.typee != eulTypeBytes32 && compiled.typee != eulTypeAddress && compiled.typee != eulTypei64 {
+		log.Fatalf("%s:%d:%d ERROR '%s' can't hash argument of type '%s'",
+			arg.loc.filepath, arg.loc.row, arg.loc.col, funcCall.name, eulTypes[compiled.typee])
+	}
+
+	easm.pushInstruction(eulvm.Instruction{
+		OpCode:  eulvm.NATIVE,
+		Operand: *uint256.NewInt(native),
+	})
+}
+
 func (e *eulang) compileNativeWriteIntoEasm(easm *easm, funcall eulFuncCall) {
 	e.compileExprIntoEasm(easm, funcall.args[0].value)
 	easm.pushInstruction(eulvm.Instruction{
@@ -625,7 +1295,8 @@ func (e *eulang) compileNativeWriteIntoEasm(easm *easm, funcall eulFuncCall) {
 	})
 }
 
-func (e *eulang) compileFuncCallIntoEasm(easm *easm, funcCall eulFuncCall) {
+// compileFuncCallIntoEasm leaves the result of the function on the stack if it isn't void
+func (e *eulang) compileFuncCallIntoEasm(easm *easm, funcCall eulFuncCall) eulType {
 	//TODO add deffered compiled function addresses resolving later
 	compiledFunc, ok := e.funcs[funcCall.name]
 	if !ok {
@@ -660,6 +1331,7 @@ func (e *eulang) compileFuncCallIntoEasm(easm *easm, funcCall eulFuncCall) {
 	})
 
 	e.compilePopFrame(easm)
+	return compiledFunc.returns
 }
 
 func (e *eulang) pushNewScope() {
@@ -808,6 +1480,15 @@ func (e *eulang) prepareVarStack(easm *easm, stackSize uint) {
 	e.stackFrameAddr = result
 }
 
+// Symbols returns names of compiled functions by their addresses
+func (e *eulang) Symbols() map[int]string {
+	symbols := make(map[int]string, len(e.funcs))
+	for name, f := range e.funcs {
+		symbols[f.addr] = name
+	}
+	return symbols
+}
+
 // // TODO euler later can add here function arguments
 func (e *eulang) GenerateInput(method string, args []string) []byte {
 	var input []byte
@@ -824,7 +1505,8 @@ func (e *eulang) GenerateInput(method string, args []string) []byte {
 			if err != nil {
 				log.Fatalf("param arg types doesn't match. Cant convert '%v' to int", args[i])
 			}
-			arg := uint256.NewInt(uint64(argi64)).Bytes32()
+			word := i64Word(int64(argi64))
+			arg := word.Bytes32()
 			input = append(input, arg[:]...)
 		case eulTypeBool:
 			var arg [32]byte
@@ -860,3 +1542,56 @@ func (e *eulang) GenerateInput(method string, args []string) []byte {
 	}
 	return input[:]
 }
+
+// FormatReturn decodes the data returned by external method into the eulang view of its value
+func (e *eulang) FormatReturn(method string, data []byte) string {
+	f, ok := e.funcs[method]
+	if !ok {
+		log.Fatalf("method '%s' doesn't exist", method)
+	}
+	if f.returns == eulTypeVoid {
+		return ""
+	}
+	if len(data) != int(eulvm.WordLength.Uint64()) {
+		log.Fatalf("method '%s' returned %d bytes but want %d", method, len(data), eulvm.WordLength.Uint64())
+	}
+
+	return formatWord(f.returns, data)
+}
+
+// FormatLog decodes the log emitted by declared event as Event(param: value, ...)
+func (e *eulang) FormatLog(l eulvm.Log) string {
+	for _, event := range e.events {
+		if len(l.Topics) == 0 || l.Topics[0] != event.topic {
+			continue
+		}
+		if len(l.Data) != len(event.params)*int(eulvm.WordLength.Uint64()) {
+			break
+		}
+		s := event.name + "("
+		for i, param := range event.params {
+			if i > 0 {
+				s += ", "
+			}
+			s += param.name + ": " + formatWord(param.typee, l.Data[i*32:(i+1)*32])
+		}
+		return s + ")"
+	}
+	return fmt.Sprintf("unknown event topics %v data 0x%x", l.Topics, l.Data)
+}
+
+// formatWord decodes 32 bytes word of the type
+func formatWord(t eulType, data []byte) string {
+	switch t {
+	case eulTypei64:
+		return strconv.FormatInt(int64(new(uint256.Int).SetBytes(data).Uint64()), 10)
+	case eulTypeBool:
+		return strconv.FormatBool(new(uint256.Int).SetBytes(data).Uint64() != 0)
+	case eulTypeBytes32:
+		return common.BytesToHash(data).Hex()
+	case eulTypeAddress:
+		return common.BytesToAddress(data).Hex()
+	default:
+		panic("unrecognized eulang type")
+	}
+}
@@ -1,8 +1,366 @@
 package compiler
 
 import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/Unheilbar/eulang/eulvm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_compileFuncCallIntoEasm(t *testing.T) {
 }
+
+// compileTestSource compiles eulang source through a temporary file
+func compileTestSource(t *testing.T, eulang *eulang, src string) eulvm.Program {
+	file := filepath.Join(t.TempDir(), "test.eul")
+	assert.NoError(t, os.WriteFile(file, []byte(src), 0644))
+	return CompileFromSource(eulang, file)
+}
+
+func Test_CompileExternFunc(t *testing.T) {
+	natives := eulvm.NewNativeRegistry()
+	var reported []int64
+	_, err := natives.Register("double", eulvm.NativeSignature{
+		Params:  []eulvm.NativeType{eulvm.NativeI64},
+		Returns: eulvm.NativeI64,
+	}, func(args []eulvm.Word) (eulvm.Word, error) {
+		var res eulvm.Word
+		return *res.Add(&args[0], &args[0]), nil
+	})
+	assert.NoError(t, err)
+	_, err = natives.Register("report", eulvm.NativeSignature{
+		Params: []eulvm.NativeType{eulvm.NativeI64, eulvm.NativeBool},
+	}, func(args []eulvm.Word) (eulvm.Word, error) {
+		if args[1].IsZero() {
+			reported = append(reported, -int64(args[0].Uint64()))
+		} else {
+			reported = append(reported, int64(args[0].Uint64()))
+		}
+		return eulvm.Word{}, nil
+	})
+	assert.NoError(t, err)
+
+	src := `
+extern func double(x i64) i64
+extern func report(x i64, positive bool)
+
+func entry(a i64) external {
+	report(double(a) + 1, true)
+	report(double(double(a)), false)
+}
+`
+	eulang := NewEulang().WithNatives(natives)
+	prog := compileTestSource(t, eulang, src)
+
+	e := eulvm.New(prog).WithNatives(natives)
+	assert.NoError(t, e.Verify())
+
+	input := eulang.GenerateInput("entry", []string{"5"})
+	_, err = e.Run(input, 100_000)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{11, -20}, reported)
+
+	// extern calls are checked by verifier against the registry of the vm
+	_, err = eulvm.NewVerified(prog)
+	assert.Error(t, err)
+}
+
+func Test_CompileReturn(t *testing.T) {
+	src := `
+func abs(a i64) i64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func sum(n i64) i64 {
+	var i i64
+	var s i64
+	i = 0
+	s = 0
+	while true {
+		if i > n {
+			return s
+		}
+		s = s + abs(i) * 2
+		i = i + 1
+	}
+	return -1
+}
+
+func entry(a i64) external {
+	writef("%d %d %d", abs(a), abs(-a) + abs(3), sum(4))
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+	res, err := e.WithOutput(io.Discard).Run(eulang.GenerateInput("entry", []string{"-5"}), 1_000_000)
+	assert.NoError(t, err)
+	assert.Equal(t, "5 8 20", string(res.Output))
+}
+
+func Test_CompileExternalReturn(t *testing.T) {
+	src := `
+func double(a i64) i64 {
+	return a * 2
+}
+
+func calc(a i64) i64 external {
+	if a < 0 {
+		return double(a) - 1
+	}
+	return double(a)
+}
+
+func positive(a i64) bool external {
+	return a > 0
+}
+
+func noop() external {
+	return
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+
+	res, err := e.Run(eulang.GenerateInput("calc", []string{"-5"}), 1_000_000)
+	assert.NoError(t, err)
+	want := new(uint256.Int).Neg(uint256.NewInt(11)).Bytes32()
+	assert.Equal(t, want[:], res.ReturnData)
+	assert.Equal(t, "-11", eulang.FormatReturn("calc", res.ReturnData))
+
+	res, err = e.Run(eulang.GenerateInput("positive", []string{"3"}), 1_000_000)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", eulang.FormatReturn("positive", res.ReturnData))
+
+	res, err = e.Run(eulang.GenerateInput("noop", nil), 1_000_000)
+	assert.NoError(t, err)
+	assert.Nil(t, res.ReturnData)
+}
+
+func Test_CompileRequire(t *testing.T) {
+	src := `
+map counters [i64] i64
+
+func check(a i64) {
+	assert(a < 100)
+}
+
+func inc(a i64) external {
+	counters[1] = counters[1] + 1
+	require(a > 0, "a must be positive")
+	check(a)
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+
+	db := eulvm.NewMemoryStateDB()
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+	e.WithStateDB(db)
+
+	_, err = e.Run(eulang.GenerateInput("inc", []string{"5"}), 1_000_000)
+	assert.NoError(t, err)
+	root := db.Root()
+
+	var rerr *eulvm.RevertError
+	_, err = e.Run(eulang.GenerateInput("inc", []string{"-5"}), 1_000_000)
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "a must be positive", rerr.Reason)
+
+	_, err = e.Run(eulang.GenerateInput("inc", []string{"500"}), 1_000_000)
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "assertion failed", rerr.Reason)
+
+	assert.Equal(t, root, db.Root())
+}
+
+func Test_CompileSourceMap(t *testing.T) {
+	src := `
+func check(a i64) {
+	assert(a < 100)
+}
+
+func run(a i64) external {
+	check(a)
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+	assert.Equal(t, len(prog.Instrutions), len(prog.SourceMap))
+
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+	_, err = e.Run(eulang.GenerateInput("run", []string{"500"}), 1_000_000)
+
+	var serr *eulvm.SourceError
+	assert.True(t, errors.As(err, &serr))
+	assert.Equal(t, "test.eul", filepath.Base(serr.Loc.File))
+	assert.Equal(t, 3, serr.Loc.Row)
+	assert.Equal(t, "check", serr.Loc.Func)
+	assert.Contains(t, err.Error(), "test.eul:3:")
+
+	var rerr *eulvm.RevertError
+	assert.True(t, errors.As(err, &rerr))
+}
+
+func Test_CompileEmit(t *testing.T) {
+	src := `
+event Deposit(to address, amount i64, big bool)
+event Pair(a i64, b i64)
+
+func deposit(to address, amount i64) external {
+	emit Deposit(to, amount, amount > 100)
+	require(amount > 0, "zero deposit")
+}
+
+func inner() i64 {
+	emit Pair(7, 8)
+	return 9
+}
+
+func nested() external {
+	emit Pair(1, inner())
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+
+	to := "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	res, err := e.Run(eulang.GenerateInput("deposit", []string{to, "-1"}), 1_000_000)
+	assert.Error(t, err)
+	assert.Nil(t, res.Logs)
+
+	res, err = e.Run(eulang.GenerateInput("deposit", []string{to, "500"}), 1_000_000)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Logs, 1) {
+		l := res.Logs[0]
+		assert.Equal(t, []common.Hash{crypto.Keccak256Hash([]byte("Deposit(address,i64,bool)"))}, l.Topics)
+		assert.Len(t, l.Data, 3*32)
+		assert.Equal(t, "Deposit(to: 0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed, amount: 500, big: true)", eulang.FormatLog(l))
+	}
+
+	// emit nested into the args of the same event doesn't overwrite them
+	res, err = e.Run(eulang.GenerateInput("nested", nil), 1_000_000)
+	assert.NoError(t, err)
+	if assert.Len(t, res.Logs, 2) {
+		assert.Equal(t, "Pair(a: 7, b: 8)", eulang.FormatLog(res.Logs[0]))
+		assert.Equal(t, "Pair(a: 1, b: 9)", eulang.FormatLog(res.Logs[1]))
+	}
+}
+
+func Test_CompileContext(t *testing.T) {
+	src := `
+func withdraw(owner address, unlock i64) i64 external {
+	require(msg.sender == owner, "not owner")
+	require(block.timestamp > unlock, "locked")
+	return block.number * 1000 + block.chainid
+}
+`
+	eulang := NewEulang()
+	prog := compileTestSource(t, eulang, src)
+
+	e, err := eulvm.NewVerified(prog)
+	assert.NoError(t, err)
+
+	owner := common.HexToAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed")
+	input := eulang.GenerateInput("withdraw", []string{owner.Hex(), "100"})
+
+	var rerr *eulvm.RevertError
+	_, err = e.WithContext(eulvm.Context{Timestamp: 200}).Run(input, 1_000_000)
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "not owner", rerr.Reason)
+
+	_, err = e.WithContext(eulvm.Context{Caller: owner, Timestamp: 50}).Run(input, 1_000_000)
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "locked", rerr.Reason)
+
+	ctx := eulvm.Context{Caller: owner, Origin: owner, BlockNumber: 7, Timestamp: 200, ChainID: 5}
+	res, err := e.WithContext(ctx).Run(input, 1_000_000)
+	assert.NoError(t, err)
+	assert.Equal(t, "7005", eulang.FormatReturn("withdraw", res.ReturnData))
+}
+
+func Test_CompileExtCall(t *testing.T) {
+	dir := t.TempDir()
+	token := `
+map balances [address] i64
+
+event Transfer(from address, to address, amount i64)
+
+func mint(to address, amount i64) external {
+	balances[to] = balances[to] + amount
+}
+
+func transfer(to address, amount i64) external {
+	require(amount < balances[msg.sender] + 1, "insufficient balance")
+	balances[msg.sender] = balances[msg.sender] - amount
+	balances[to] = balances[to] + amount
+	emit Transfer(msg.sender, to, amount)
+}
+
+func balanceOf(owner address) i64 external {
+	return balances[owner]
+}
+`
+	vault := `
+contract Token "token.eul"
+
+func deposit(token address, amount i64) i64 external {
+	Token(token).transfer(msg.sender, amount)
+	return Token(token).balanceOf(msg.sender)
+}
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token.eul"), []byte(token), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "vault.eul"), []byte(vault), 0644))
+
+	tokenEulang := NewEulang()
+	tokenProg := CompileFromSource(tokenEulang, filepath.Join(dir, "token.eul"))
+	vaultEulang := NewEulang()
+	vaultProg := CompileFromSource(vaultEulang, filepath.Join(dir, "vault.eul"))
+
+	tokenAddr := common.HexToAddress("0x01")
+	vaultAddr := common.HexToAddress("0x02")
+	user := common.HexToAddress("0x03")
+	host := eulvm.NewHost().WithOutput(io.Discard)
+	assert.NoError(t, host.Deploy(tokenAddr, tokenProg))
+	assert.NoError(t, host.Deploy(vaultAddr, vaultProg))
+
+	_, err := host.Call(eulvm.Context{Caller: user}, tokenAddr,
+		tokenEulang.GenerateInput("mint", []string{vaultAddr.Hex(), "100"}), 1_000_000)
+	assert.NoError(t, err)
+
+	// vault sends its tokens to the caller
+	input := vaultEulang.GenerateInput("deposit", []string{tokenAddr.Hex(), "30"})
+	res, err := host.Call(eulvm.Context{Caller: user}, vaultAddr, input, 1_000_000)
+	assert.NoError(t, err)
+	assert.Equal(t, "30", vaultEulang.FormatReturn("deposit", res.ReturnData))
+	if assert.Len(t, res.Logs, 1) {
+		assert.Equal(t, "Transfer(from: "+vaultAddr.Hex()+", to: "+user.Hex()+", amount: 30)", tokenEulang.FormatLog(res.Logs[0]))
+	}
+
+	// revert of the token fails the vault call
+	input = vaultEulang.GenerateInput("deposit", []string{tokenAddr.Hex(), "500"})
+	_, err = host.Call(eulvm.Context{Caller: user}, vaultAddr, input, 1_000_000)
+	var rerr *eulvm.RevertError
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "insufficient balance", rerr.Reason)
+}
@@ -28,6 +28,8 @@ const (
 	eulTokenKindPlus
 	eulTokenKindMinus
 	eulTokenKindMult
+	eulTokenKindDiv
+	eulTokenKindMod
 	eulTokenKindLt
 	eulTokenKindGt
 	eulTokenKindGe
@@ -36,6 +38,13 @@ const (
 	eulTokenKindOr
 	eulTokenKindEqEq
 	eulTokenKindDotDot
+	eulTokenKindBitAnd
+	eulTokenKindBitOr
+	eulTokenKindXor
+	eulTokenKindTilde
+	eulTokenKindShl
+	eulTokenKindShr
+	eulTokenKindDot
 	//add here
 
 	eulTokenKindKinds
@@ -67,6 +76,13 @@ var hardcodedTokens = []hardcodedToken{
 	{eulTokenKindAnd, "&&"},
 	{eulTokenKindNe, "!="},
 	{eulTokenKindGe, ">="},
+	{eulTokenKindShl, "<<"},
+	{eulTokenKindShr, ">>"},
+	{eulTokenKindDot, "."},
+	{eulTokenKindBitAnd, "&"},
+	{eulTokenKindBitOr, "|"},
+	{eulTokenKindXor, "^"},
+	{eulTokenKindTilde, "~"},
 	{eulTokenKindOpenParen, "("},
 	{eulTokenKindCloseParen, ")"},
 	{eulTokenKindOpenCurly, "{"},
@@ -78,6 +94,8 @@ var hardcodedTokens = []hardcodedToken{
 	{eulTokenKindPlus, "+"},
 	{eulTokenKindMinus, "-"},
 	{eulTokenKindMult, "*"},
+	{eulTokenKindDiv, "/"},
+	{eulTokenKindMod, "%"},
 	{eulTokenKindLt, "<"},
 	{eulTokenKindGt, ">"},
 	{eulTokenKindOpenBrack, "["},
@@ -99,6 +117,8 @@ var tokenKindNames = map[eulTokenKind]string{
 	eulTokenKindPlus:       "+",
 	eulTokenKindMinus:      "-",
 	eulTokenKindMult:       "*",
+	eulTokenKindDiv:        "/",
+	eulTokenKindMod:        "%",
 	eulTokenKindLt:         "<",
 	eulTokenKindGt:         ">",
 	eulTokenKindGe:         ">=",
@@ -106,6 +126,13 @@ var tokenKindNames = map[eulTokenKind]string{
 	eulTokenKindAnd:        "&&",
 	eulTokenKindOr:         "||",
 	eulTokenKindDotDot:     "..",
+	eulTokenKindBitAnd:     "&",
+	eulTokenKindBitOr:      "|",
+	eulTokenKindXor:        "^",
+	eulTokenKindTilde:      "~",
+	eulTokenKindShl:        "<<",
+	eulTokenKindShr:        ">>",
+	eulTokenKindDot:        ".",
 	eulTokenKindLitStr:     "string literal",
 	eulTokenKindOpenBrack:  "[",
 	eulTokenKindCloseBrack: "]",
@@ -47,6 +47,9 @@ const (
 	eulExprKindVarRead
 	eulExprKindMapRead
 	eulExprKindBinaryOp
+	eulExprKindUnaryOp
+	eulExprKindContextRead
+	eulExprKindExtCall
 	//... to be continued
 )
 
@@ -59,6 +62,9 @@ type eulExprAs struct {
 	varRead    varRead
 	mapRead    *mapRead
 	binaryOp   *binaryOp
+	unaryOp    *unaryOp
+	ctxRead    contextRead
+	extCall    *extCall
 	bytes32Lit common.Hash
 	//... to be continued
 }
@@ -78,6 +84,8 @@ const (
 	eulStmtKindMapWrite
 	eulStmtKindWhile
 	eulStmtKindVarDef
+	eulStmtKindReturn
+	eulStmtKindEmit
 )
 
 type eulStatementAs struct {
@@ -87,6 +95,8 @@ type eulStatementAs struct {
 	mapWrite  eulMapWrite
 	while     eulWhile
 	vardef    eulVarDef
+	ret       eulReturn
+	emit      eulEmit
 }
 
 type eulStatement struct {
@@ -94,6 +104,42 @@ type eulStatement struct {
 	kind eulStmtKind
 }
 
+func (stmt eulStatement) loc() eulLoc {
+	switch stmt.kind {
+	case eulStmtKindExpr:
+		return stmt.as.expr.loc
+	case eulStmtKindIf:
+		return stmt.as.eif.loc
+	case eulStmtKindVarAssign:
+		return stmt.as.varAssign.loc
+	case eulStmtKindWhile:
+		return stmt.as.while.loc
+	case eulStmtKindVarDef:
+		return stmt.as.vardef.loc
+	case eulStmtKindMapWrite:
+		return stmt.as.mapWrite.loc
+	case eulStmtKindReturn:
+		return stmt.as.ret.loc
+	case eulStmtKindEmit:
+		return stmt.as.emit.loc
+	}
+	return eulLoc{}
+}
+
+type eulReturn struct {
+	loc      eulLoc
+	value    eulExpr
+	hasValue bool
+}
+
+// eulEmit logs the event with the args
+//
+//	emit Transfer(from, to, amount)
+type eulEmit struct {
+	loc  eulLoc
+	call eulFuncCall
+}
+
 type eulBlock struct {
 	statements []eulStatement
 }
@@ -109,12 +155,43 @@ const (
 type eulFuncDef struct {
 	name     string
 	modifier eulFuncModifier
+	returns  eulType
 
 	body   eulBlock
 	loc    eulLoc
 	params []eulFuncParam
 }
 
+// eulExternDef declares native function registered by the host
+//
+//	extern func name(a i64, b bytes32) bytes32
+//
+// return type can be omitted for void natives
+type eulExternDef struct {
+	name    string
+	loc     eulLoc
+	params  []eulFuncParam
+	returns eulType
+}
+
+// eulEventDef declares event that can be emitted by contract functions
+//
+//	event Transfer(from address, to address, amount i64)
+type eulEventDef struct {
+	name   string
+	loc    eulLoc
+	params []eulFuncParam
+}
+
+// eulContractDef imports external funcs of another contract from its source, path is relative to the importing file
+//
+//	contract Token "token.eul"
+type eulContractDef struct {
+	name string
+	loc  eulLoc
+	path string
+}
+
 type eulType uint8
 
 const (
@@ -172,6 +249,22 @@ type varRead struct {
 	loc  eulLoc
 }
 
+// extCall calls external func of another contract
+//
+//	Token(tokenAddr).transfer(to, amount)
+type extCall struct {
+	loc      eulLoc
+	contract string
+	target   eulExpr // address of the called contract
+	method   eulFuncCall
+}
+
+// contextRead reads field of the execution context, name includes the namespace (msg.sender, block.number)
+type contextRead struct {
+	name string
+	loc  eulLoc
+}
+
 type mapRead struct {
 	name string
 	key  eulExpr
@@ -196,6 +289,13 @@ const (
 	binaryOpKindAnd
 	binaryOpKindOr
 	binaryOpKindMulti
+	binaryOpKindDiv
+	binaryOpKindMod
+	binaryOpKindBitAnd
+	binaryOpKindBitOr
+	binaryOpKindXor
+	binaryOpKindShl
+	binaryOpKindShr
 
 	countBinaryOpKinds //keep it last
 )
@@ -208,6 +308,24 @@ type binaryOp struct {
 	// TODO
 }
 
+type eulUnaryOpKind uint8
+
+const (
+	unaryOpKindMinus eulUnaryOpKind = iota
+	unaryOpKindBitNot
+)
+
+type unaryOp struct {
+	loc     eulLoc
+	kind    eulUnaryOpKind
+	operand eulExpr
+}
+
+var unaryOpByToken = map[eulTokenKind]eulUnaryOpKind{
+	eulTokenKindMinus: unaryOpKindMinus,
+	eulTokenKindTilde: unaryOpKindBitNot,
+}
+
 type binaryOpDef struct {
 	prec  eulBinaryOpPrecedence
 	token eulTokenKind
@@ -215,13 +333,38 @@ type binaryOpDef struct {
 }
 
 var binaryOpDefs = map[eulBinaryOpKind]binaryOpDef{
-	// multi/div
+	// multi/div, bitwise and, shifts (same as in go)
 	binaryOpKindMulti: {
 		token: eulTokenKindMult,
 		prec:  eulBinOpPrecedence3,
 		kind:  binaryOpKindMulti,
 	},
-	// arithmetc precedence 2
+	binaryOpKindDiv: {
+		token: eulTokenKindDiv,
+		prec:  eulBinOpPrecedence3,
+		kind:  binaryOpKindDiv,
+	},
+	binaryOpKindMod: {
+		token: eulTokenKindMod,
+		prec:  eulBinOpPrecedence3,
+		kind:  binaryOpKindMod,
+	},
+	binaryOpKindBitAnd: {
+		token: eulTokenKindBitAnd,
+		prec:  eulBinOpPrecedence3,
+		kind:  binaryOpKindBitAnd,
+	},
+	binaryOpKindShl: {
+		token: eulTokenKindShl,
+		prec:  eulBinOpPrecedence3,
+		kind:  binaryOpKindShl,
+	},
+	binaryOpKindShr: {
+		token: eulTokenKindShr,
+		prec:  eulBinOpPrecedence3,
+		kind:  binaryOpKindShr,
+	},
+	// arithmetc precedence 2, bitwise or/xor
 	binaryOpKindPlus: {
 		token: eulTokenKindPlus,
 		prec:  eulBinOpPrecedence2,
@@ -232,6 +375,16 @@ var binaryOpDefs = map[eulBinaryOpKind]binaryOpDef{
 		prec:  eulBinOpPrecedence2,
 		kind:  binaryOpKindMinus,
 	},
+	binaryOpKindBitOr: {
+		token: eulTokenKindBitOr,
+		prec:  eulBinOpPrecedence2,
+		kind:  binaryOpKindBitOr,
+	},
+	binaryOpKindXor: {
+		token: eulTokenKindXor,
+		prec:  eulBinOpPrecedence2,
+		kind:  binaryOpKindXor,
+	},
 	// comparison precedence 1
 	binaryOpKindLess: {
 		token: eulTokenKindLt,
@@ -291,12 +444,18 @@ const (
 	eulTopKindFunc = iota
 	eulTopKindVar
 	eulTopKindMap
+	eulTopKindExtern
+	eulTopKindEvent
+	eulTopKindContract
 )
 
 type eulTopAs struct {
-	vdef eulVarDef
-	fdef eulFuncDef
-	mdef eulMapDef
+	vdef  eulVarDef
+	fdef  eulFuncDef
+	mdef  eulMapDef
+	edef  eulExternDef
+	evdef eulEventDef
+	cdef  eulContractDef
 }
 
 type eulTop struct {
@@ -334,6 +493,21 @@ func parseEulModule(lex *lexer) eulModule {
 
 			top.as.mdef = mdef
 			top.kind = eulTopKindMap
+		case "extern":
+			edef := parseExternDef(lex)
+
+			top.as.edef = edef
+			top.kind = eulTopKindExtern
+		case "event":
+			evdef := parseEventDef(lex)
+
+			top.as.evdef = evdef
+			top.kind = eulTopKindEvent
+		case "contract":
+			cdef := parseContractDef(lex)
+
+			top.as.cdef = cdef
+			top.kind = eulTopKindContract
 		default:
 			log.Fatalf("%s:%d:%d expected module definitions but got keyword %s", t.loc.filepath, t.loc.row, t.loc.col, t.view)
 		}
@@ -391,6 +565,7 @@ func parseFuncDef(lex *lexer) eulFuncDef {
 	f.name = t.view
 
 	f.params = parseFuncDefParams(lex)
+	f.returns = parseFuncReturnType(lex)
 
 	//If function has modifier then parse it
 	{
@@ -415,6 +590,52 @@ func parseFuncDef(lex *lexer) eulFuncDef {
 	return f
 }
 
+func parseExternDef(lex *lexer) eulExternDef {
+	var edef eulExternDef
+	lex.expectKeyword("extern")
+	lex.expectKeyword("func")
+	t := lex.expectToken(eulTokenKindName)
+	edef.loc = t.loc
+	edef.name = t.view
+	edef.params = parseFuncDefParams(lex)
+	edef.returns = parseFuncReturnType(lex)
+
+	return edef
+}
+
+func parseContractDef(lex *lexer) eulContractDef {
+	var cdef eulContractDef
+	lex.expectKeyword("contract")
+	t := lex.expectToken(eulTokenKindName)
+	cdef.loc = t.loc
+	cdef.name = t.view
+	cdef.path = lex.expectToken(eulTokenKindLitStr).view
+
+	return cdef
+}
+
+func parseEventDef(lex *lexer) eulEventDef {
+	var evdef eulEventDef
+	lex.expectKeyword("event")
+	t := lex.expectToken(eulTokenKindName)
+	evdef.loc = t.loc
+	evdef.name = t.view
+	evdef.params = parseFuncDefParams(lex)
+
+	return evdef
+}
+
+// parseFuncReturnType parses optional return type after func params. Functions without it return void
+func parseFuncReturnType(lex *lexer) eulType {
+	var t token
+	if lex.peek(&t, 0) && t.kind == eulTokenKindName {
+		if _, ok := eulTypesView[t.view]; ok {
+			return parseEulType(lex)
+		}
+	}
+	return eulTypeVoid
+}
+
 func parseFuncDefParams(lex *lexer) []eulFuncParam {
 	var result []eulFuncParam
 
@@ -500,6 +721,16 @@ func parseEulStmt(lex *lexer) eulStatement {
 			stmt.kind = eulStmtKindVarDef
 			stmt.as.vardef = parseVarDef(lex)
 			return stmt
+		case "return":
+			var stmt eulStatement
+			stmt.kind = eulStmtKindReturn
+			stmt.as.ret = parseEulReturn(lex)
+			return stmt
+		case "emit":
+			var stmt eulStatement
+			stmt.kind = eulStmtKindEmit
+			stmt.as.emit = parseEulEmit(lex)
+			return stmt
 		default:
 			var nt token
 			if lex.peek(&nt, 1) && nt.kind == eulTokenKindEq {
@@ -526,6 +757,27 @@ func parseEulStmt(lex *lexer) eulStatement {
 	return stmt
 }
 
+// return without value must be the last statement of the block
+func parseEulReturn(lex *lexer) eulReturn {
+	var ret eulReturn
+	t := lex.expectKeyword("return")
+	ret.loc = t.loc
+
+	if lex.peek(&t, 0) && t.kind != eulTokenKindCloseCurly {
+		ret.hasValue = true
+		ret.value = parseEulExpr(lex)
+	}
+	return ret
+}
+
+func parseEulEmit(lex *lexer) eulEmit {
+	var emit eulEmit
+	t := lex.expectKeyword("emit")
+	emit.loc = t.loc
+	emit.call = parseFuncCall(lex)
+	return emit
+}
+
 func parseCurlyEulBlock(lex *lexer) *eulBlock {
 	lex.expectToken(eulTokenKindOpenCurly)
 	var t = &token{}
@@ -592,13 +844,22 @@ func parsePrimaryExpr(lex *lexer) eulExpr {
 			if lex.peek(&nextTok, 1) && nextTok.kind == eulTokenKindOpenParen {
 				funcall := parseFuncCall(lex)
 				expr.loc = t.loc
-				expr.kind = eulExprKindFuncCall
-				expr.as.funcCall = funcall
+				if lex.peek(&nextTok, 0) && nextTok.kind == eulTokenKindDot {
+					expr.kind = eulExprKindExtCall
+					expr.as.extCall = parseExtCall(lex, funcall)
+				} else {
+					expr.kind = eulExprKindFuncCall
+					expr.as.funcCall = funcall
+				}
 			} else if nextTok.kind == eulTokenKindOpenBrack {
 				mapRead := parseMapRead(lex)
 				expr.loc = t.loc
 				expr.kind = eulExprKindMapRead
 				expr.as.mapRead = &mapRead
+			} else if nextTok.kind == eulTokenKindDot {
+				expr.kind = eulExprKindContextRead
+				expr.loc = t.loc
+				expr.as.ctxRead = parseContextRead(lex)
 			} else {
 				// It's most likely var read
 				expr.kind = eulExprKindVarRead
@@ -620,6 +881,15 @@ func parsePrimaryExpr(lex *lexer) eulExpr {
 		lex.next(&t)
 		expr = parseEulExpr(lex)
 		lex.expectToken(eulTokenKindCloseParen)
+	case eulTokenKindMinus, eulTokenKindTilde:
+		lex.next(&t)
+		expr.kind = eulExprKindUnaryOp
+		expr.loc = t.loc
+		expr.as.unaryOp = &unaryOp{
+			loc:     t.loc,
+			kind:    unaryOpByToken[t.kind],
+			operand: parsePrimaryExpr(lex),
+		}
 	default:
 		log.Fatalf("%s:%d:%d no primary expression starts with %s",
 			lex.filepath, lex.row, lex.lineStart, t.view)
@@ -686,6 +956,32 @@ func parseMapRead(lex *lexer) mapRead {
 	return mr
 }
 
+// parseExtCall parses method call after the contract cast is parsed as func call
+func parseExtCall(lex *lexer, cast eulFuncCall) *extCall {
+	if len(cast.args) != 1 {
+		log.Fatalf("%s:%d:%d contract '%s' expects exactly one address but got %d arguments",
+			cast.loc.filepath, cast.loc.row, cast.loc.col, cast.name, len(cast.args))
+	}
+	lex.expectToken(eulTokenKindDot)
+
+	var call extCall
+	call.loc = cast.loc
+	call.contract = cast.name
+	call.target = cast.args[0].value
+	call.method = parseFuncCall(lex)
+	return &call
+}
+
+// parseContextRead parses builtin execution context field like msg.sender
+func parseContextRead(lex *lexer) contextRead {
+	var cr contextRead
+	t := lex.expectToken(eulTokenKindName)
+	cr.loc = t.loc
+	lex.expectToken(eulTokenKindDot)
+	cr.name = t.view + "." + lex.expectToken(eulTokenKindName).view
+	return cr
+}
+
 func parseVarRead(lex *lexer) varRead {
 	var vr varRead
 	t := lex.expectToken(eulTokenKindName)
@@ -2,7 +2,43 @@ package compiler
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_parseFuncDef(t *testing.T) {
 }
+
+func Test_parseEulExprPrecedence(t *testing.T) {
+	lex := NewLexer([]string{" ", "a - b * c / d % e"}, "test.eul")
+	expr := parseEulExpr(lex)
+
+	// a - (((b * c) / d) % e)
+	assert.Equal(t, eulExprKindBinaryOp, expr.kind)
+	assert.Equal(t, binaryOpKindMinus, expr.as.binaryOp.kind)
+	assert.Equal(t, "a", expr.as.binaryOp.lhs.as.varRead.name)
+
+	mod := expr.as.binaryOp.rhs.as.binaryOp
+	assert.Equal(t, binaryOpKindMod, mod.kind)
+	assert.Equal(t, "e", mod.rhs.as.varRead.name)
+
+	div := mod.lhs.as.binaryOp
+	assert.Equal(t, binaryOpKindDiv, div.kind)
+	assert.Equal(t, "d", div.rhs.as.varRead.name)
+
+	mul := div.lhs.as.binaryOp
+	assert.Equal(t, binaryOpKindMulti, mul.kind)
+	assert.Equal(t, "b", mul.lhs.as.varRead.name)
+	assert.Equal(t, "c", mul.rhs.as.varRead.name)
+}
+
+func Test_parseContextRead(t *testing.T) {
+	lex := NewLexer([]string{" ", "msg.sender == owner"}, "test.eul")
+	expr := parseEulExpr(lex)
+
+	assert.Equal(t, eulExprKindBinaryOp, expr.kind)
+	lhs := expr.as.binaryOp.lhs
+	assert.Equal(t, eulExprKindContextRead, lhs.kind)
+	assert.Equal(t, "msg.sender", lhs.as.ctxRead.name)
+	assert.Equal(t, "owner", expr.as.binaryOp.rhs.as.varRead.name)
+}
@@ -0,0 +1,272 @@
+package eulvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// Binary format of the compiled program. All integers are big endian, uvarint is protobuf style varint.
+//
+//	magic     4 bytes  "EUL\x00"
+//	version   1 byte   BytecodeVersion
+//	sections  repeated
+//	  id      1 byte
+//	  length  uvarint  size of payload
+//	  payload length bytes
+//	checksum  4 bytes  crc32 (IEEE) of everything before it
+//
+// Sections:
+//
+//	code (0x01)  uvarint count of instructions, then for every instruction:
+//	             opcode (1 byte), operand size (1 byte, 0..32), operand without leading zeros
+//	data (0x02)  PreallocMemory as is
+//	srcmap (0x03) optional SourceMap. uvarint count of strings, then every string as uvarint length and bytes.
+//	             Then uvarint count of entries, equal to count of instructions, and for every entry uvarints:
+//	             file index + 1, row, col, function index + 1. Zero index means empty string
+//
+// Every section may appear only once. Code section is required.
+const BytecodeVersion byte = 1
+
+var bytecodeMagic = []byte{'E', 'U', 'L', 0}
+
+const (
+	sectionCode      byte = 0x01
+	sectionData      byte = 0x02
+	sectionSourceMap byte = 0x03
+)
+
+var (
+	ErrBytecodeMagic    = errors.New("bytecode: invalid magic header")
+	ErrBytecodeVersion  = errors.New("bytecode: unsupported format version")
+	ErrBytecodeChecksum = errors.New("bytecode: checksum mismatch")
+	ErrBytecodeCorrupt  = errors.New("bytecode: corrupted data")
+)
+
+const checksumSize = 4
+
+// MarshalBinary encodes the program into the bytecode format
+func (p *Program) MarshalBinary() ([]byte, error) {
+	if len(p.SourceMap) != 0 && len(p.SourceMap) != len(p.Instrutions) {
+		return nil, fmt.Errorf("bytecode: source map has %d entries for %d instructions", len(p.SourceMap), len(p.Instrutions))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytecodeMagic)
+	buf.WriteByte(BytecodeVersion)
+
+	var code []byte
+	code = binary.AppendUvarint(code, uint64(len(p.Instrutions)))
+	for _, inst := range p.Instrutions {
+		operand := inst.Operand.Bytes()
+		code = append(code, byte(inst.OpCode), byte(len(operand)))
+		code = append(code, operand...)
+	}
+	writeSection(&buf, sectionCode, code)
+
+	if len(p.PreallocMemory) != 0 {
+		writeSection(&buf, sectionData, p.PreallocMemory)
+	}
+	if len(p.SourceMap) != 0 {
+		writeSection(&buf, sectionSourceMap, encodeSourceMap(p.SourceMap))
+	}
+
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	return buf.Bytes(), nil
+}
+
+func writeSection(buf *bytes.Buffer, id byte, payload []byte) {
+	buf.WriteByte(id)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(payload))))
+	buf.Write(payload)
+}
+
+// UnmarshalBinary decodes the program from the bytecode format
+func (p *Program) UnmarshalBinary(data []byte) error {
+	header := len(bytecodeMagic) + 1
+	if len(data) < header+checksumSize || !bytes.Equal(data[:len(bytecodeMagic)], bytecodeMagic) {
+		return ErrBytecodeMagic
+	}
+	if version := data[len(bytecodeMagic)]; version != BytecodeVersion {
+		return fmt.Errorf("%w %d", ErrBytecodeVersion, version)
+	}
+
+	body, checksum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(checksum) {
+		return ErrBytecodeChecksum
+	}
+
+	var prog Program
+	var hasCode bool
+	seen := make(map[byte]bool)
+	rest := body[header:]
+	for len(rest) > 0 {
+		id := rest[0]
+		size, n := binary.Uvarint(rest[1:])
+		if n <= 0 || size > uint64(len(rest)-1-n) {
+			return fmt.Errorf("%w: invalid size of section 0x%x", ErrBytecodeCorrupt, id)
+		}
+		payload := rest[1+n : 1+n+int(size)]
+		rest = rest[1+n+int(size):]
+
+		if seen[id] {
+			return fmt.Errorf("%w: duplicated section 0x%x", ErrBytecodeCorrupt, id)
+		}
+		seen[id] = true
+
+		switch id {
+		case sectionCode:
+			instrs, err := decodeCode(payload)
+			if err != nil {
+				return err
+			}
+			prog.Instrutions = instrs
+			hasCode = true
+		case sectionData:
+			prog.PreallocMemory = bytes.Clone(payload)
+		case sectionSourceMap:
+			sourceMap, err := decodeSourceMap(payload)
+			if err != nil {
+				return err
+			}
+			prog.SourceMap = sourceMap
+		default:
+			return fmt.Errorf("%w: unknown section 0x%x", ErrBytecodeCorrupt, id)
+		}
+	}
+
+	if !hasCode {
+		return fmt.Errorf("%w: missing code section", ErrBytecodeCorrupt)
+	}
+	if prog.SourceMap != nil && len(prog.SourceMap) != len(prog.Instrutions) {
+		return fmt.Errorf("%w: source map doesn't match the code", ErrBytecodeCorrupt)
+	}
+	*p = prog
+	return nil
+}
+
+func decodeCode(payload []byte) ([]Instruction, error) {
+	count, n := binary.Uvarint(payload)
+	// every instruction takes at least 2 bytes
+	if n <= 0 || count > uint64(len(payload)-n)/2 {
+		return nil, fmt.Errorf("%w: invalid instructions count", ErrBytecodeCorrupt)
+	}
+	payload = payload[n:]
+
+	var instrs []Instruction
+	for i := uint64(0); i < count; i++ {
+		if len(payload) < 2 {
+			return nil, fmt.Errorf("%w: instruction %d is truncated", ErrBytecodeCorrupt, i)
+		}
+		var inst Instruction
+		inst.OpCode = OpCode(payload[0])
+		size := int(payload[1])
+		if size > 32 || len(payload) < 2+size {
+			return nil, fmt.Errorf("%w: invalid operand of instruction %d", ErrBytecodeCorrupt, i)
+		}
+		inst.Operand.SetBytes(payload[2 : 2+size])
+		instrs = append(instrs, inst)
+		payload = payload[2+size:]
+	}
+	if len(payload) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes in code section", ErrBytecodeCorrupt)
+	}
+	return instrs, nil
+}
+
+// encodeSourceMap writes file and function names once, entries refer to them by index
+func encodeSourceMap(m SourceMap) []byte {
+	var strs []string
+	index := make(map[string]uint64)
+	ref := func(str string) uint64 {
+		if str == "" {
+			return 0
+		}
+		if _, ok := index[str]; !ok {
+			strs = append(strs, str)
+			index[str] = uint64(len(strs))
+		}
+		return index[str]
+	}
+
+	var entries []byte
+	for _, loc := range m {
+		entries = binary.AppendUvarint(entries, ref(loc.File))
+		entries = binary.AppendUvarint(entries, uint64(loc.Row))
+		entries = binary.AppendUvarint(entries, uint64(loc.Col))
+		entries = binary.AppendUvarint(entries, ref(loc.Func))
+	}
+
+	var payload []byte
+	payload = binary.AppendUvarint(payload, uint64(len(strs)))
+	for _, str := range strs {
+		payload = binary.AppendUvarint(payload, uint64(len(str)))
+		payload = append(payload, str...)
+	}
+	payload = binary.AppendUvarint(payload, uint64(len(m)))
+	return append(payload, entries...)
+}
+
+func decodeSourceMap(payload []byte) (SourceMap, error) {
+	errCorrupt := fmt.Errorf("%w: invalid source map", ErrBytecodeCorrupt)
+	next := func() (uint64, bool) {
+		v, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return 0, false
+		}
+		payload = payload[n:]
+		return v, true
+	}
+
+	count, ok := next()
+	// every string takes at least 1 byte
+	if !ok || count > uint64(len(payload)) {
+		return nil, errCorrupt
+	}
+	strs := make([]string, count)
+	for i := range strs {
+		size, ok := next()
+		if !ok || size > uint64(len(payload)) {
+			return nil, errCorrupt
+		}
+		strs[i] = string(payload[:size])
+		payload = payload[size:]
+	}
+	str := func(ref uint64) (string, bool) {
+		if ref == 0 {
+			return "", true
+		}
+		if ref > uint64(len(strs)) {
+			return "", false
+		}
+		return strs[ref-1], true
+	}
+
+	count, ok = next()
+	// every entry takes at least 4 bytes
+	if !ok || count > uint64(len(payload))/4 {
+		return nil, errCorrupt
+	}
+	m := make(SourceMap, count)
+	for i := range m {
+		var fields [4]uint64
+		for j := range fields {
+			if fields[j], ok = next(); !ok {
+				return nil, errCorrupt
+			}
+		}
+		file, okFile := str(fields[0])
+		fn, okFunc := str(fields[3])
+		if !okFile || !okFunc || fields[1] > math.MaxInt32 || fields[2] > math.MaxInt32 {
+			return nil, errCorrupt
+		}
+		m[i] = SourceLoc{File: file, Row: int(fields[1]), Col: int(fields[2]), Func: fn}
+	}
+	if len(payload) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes in source map section", ErrBytecodeCorrupt)
+	}
+	return m, nil
+}
@@ -0,0 +1,73 @@
+package eulvm
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BytecodeRoundTrip(t *testing.T) {
+	big := new(uint256.Int).SetAllOne()
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *big},
+		{OpCode: PUSH, Operand: *uint256.NewInt(300)},
+		{OpCode: ADD},
+		{OpCode: STOP},
+	}, []byte{1, 2, 3})
+
+	data, err := prog.MarshalBinary()
+	assert.NoError(t, err)
+	// 4 magic + 1 version + 2 code header + 1 count + (2+32) + (2+2) + 2 + 2 + 2 data header + 3 data + 4 checksum
+	assert.Equal(t, 59, len(data))
+
+	var decoded Program
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, prog, decoded)
+
+	empty := NewProgram(nil, nil)
+	data, err = empty.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, empty, decoded)
+}
+
+func Test_BytecodeSourceMap(t *testing.T) {
+	prog := NewProgram(counterProgram.Instrutions, nil)
+	prog.SourceMap = make(SourceMap, len(prog.Instrutions))
+	for ip := 1; ip < len(prog.SourceMap); ip++ {
+		prog.SourceMap[ip] = SourceLoc{File: "counter.eul", Row: ip, Col: 1, Func: "inc"}
+	}
+
+	data, err := prog.MarshalBinary()
+	assert.NoError(t, err)
+	var decoded Program
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, prog, decoded)
+
+	loc, ok := decoded.SourceMap.Loc(2)
+	assert.True(t, ok)
+	assert.Equal(t, "counter.eul:2:1", loc.String())
+	_, ok = decoded.SourceMap.Loc(0)
+	assert.False(t, ok)
+
+	prog.SourceMap = prog.SourceMap[1:]
+	_, err = prog.MarshalBinary()
+	assert.EqualError(t, err, "bytecode: source map has 6 entries for 7 instructions")
+}
+
+func Test_BytecodeErrors(t *testing.T) {
+	data, err := counterProgram.MarshalBinary()
+	assert.NoError(t, err)
+
+	var prog Program
+	assert.ErrorIs(t, prog.UnmarshalBinary([]byte("gob")), ErrBytecodeMagic)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[10] ^= 0xff
+	assert.ErrorIs(t, prog.UnmarshalBinary(corrupted), ErrBytecodeChecksum)
+
+	newer := append([]byte{}, data...)
+	newer[4] = BytecodeVersion + 1
+	assert.ErrorIs(t, prog.UnmarshalBinary(newer), ErrBytecodeVersion)
+}
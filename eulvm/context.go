@@ -0,0 +1,45 @@
+package eulvm
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Context describes the environment of the run. It's set by the host with WithContext and read by
+// CALLER, ORIGIN, NUMBER, TIMESTAMP and CHAINID opcodes
+type Context struct {
+	Caller common.Address // account which called the contract directly
+	Origin common.Address // account which started the transaction
+
+	BlockNumber uint64
+	Timestamp   uint64 // unix time of the block in seconds
+	ChainID     uint64
+}
+
+// WithContext sets the context for the next runs
+func (e *EulVM) WithContext(ctx Context) *EulVM {
+	e.ctx = ctx
+	return e
+}
+
+// Context returns the context of the vm
+func (e *EulVM) Context() Context {
+	return e.ctx
+}
+
+// contextWord returns the context field read by the opcode
+func (e *EulVM) contextWord(op OpCode) Word {
+	var w Word
+	switch op {
+	case CALLER:
+		w.SetBytes(e.ctx.Caller.Bytes())
+	case ORIGIN:
+		w.SetBytes(e.ctx.Origin.Bytes())
+	case NUMBER:
+		w.SetUint64(e.ctx.BlockNumber)
+	case TIMESTAMP:
+		w.SetUint64(e.ctx.Timestamp)
+	case CHAINID:
+		w.SetUint64(e.ctx.ChainID)
+	}
+	return w
+}
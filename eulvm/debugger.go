@@ -0,0 +1,224 @@
+package eulvm
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	errDebuggerNotStarted = errors.New("debugger: program isn't started")
+	errDebuggerFinished   = errors.New("debugger: program has already finished")
+	errDebuggerStopped    = errors.New("debugger: program was stopped")
+	errDebugSessionOpen   = errors.New("debugger: session is open, the vm can't run")
+)
+
+// Debugger runs the program of the vm instruction by instruction. It's used instead of Run:
+// state changes are committed or reverted the same way when the program finishes
+type Debugger struct {
+	vm *EulVM
+
+	breakpoints map[int]bool
+
+	started  bool
+	finished bool
+	err      error // error the program finished with
+	snapshot int
+}
+
+// Debugger creates debugger for the vm. Every vm may have many debuggers, but only one session can run at once
+func (e *EulVM) Debugger() *Debugger {
+	return &Debugger{
+		vm:          e,
+		breakpoints: make(map[int]bool),
+	}
+}
+
+// Start prepares the vm to run with the input. The first instruction isn't executed.
+// Open session of the vm is stopped first. Run fails until the session finishes or gets stopped
+func (d *Debugger) Start(input []byte, gasLimit uint64) {
+	if d.vm.session != nil {
+		d.vm.session.Stop()
+	}
+	d.vm.begin(input, gasLimit)
+	d.snapshot = d.vm.state.Snapshot()
+	d.vm.session = d
+	d.started = true
+	d.finished = false
+	d.err = nil
+}
+
+// Stop finishes the session which hasn't finished yet discarding its changes
+func (d *Debugger) Stop() {
+	if d.ready() == nil {
+		d.finish(errDebuggerStopped)
+	}
+}
+
+// SetBreakpoint stops Continue and StepOut before the instruction at ip is executed
+func (d *Debugger) SetBreakpoint(ip int) {
+	d.breakpoints[ip] = true
+}
+
+func (d *Debugger) ClearBreakpoint(ip int) {
+	delete(d.breakpoints, ip)
+}
+
+// Breakpoints returns sorted ips of breakpoints
+func (d *Debugger) Breakpoints() []int {
+	ips := make([]int, 0, len(d.breakpoints))
+	for ip := range d.breakpoints {
+		ips = append(ips, ip)
+	}
+	slices.Sort(ips)
+	return ips
+}
+
+// Step executes one instruction. It returns the error of the program if the instruction fails it
+func (d *Debugger) Step() error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+	return d.step()
+}
+
+// Continue executes instructions until the program finishes or reaches a breakpoint
+func (d *Debugger) Continue() error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+	for {
+		if err := d.step(); err != nil || d.finished || d.breakpoints[d.vm.ip] {
+			return err
+		}
+	}
+}
+
+// StepOut executes instructions until the current function returns, the program finishes or reaches a breakpoint
+func (d *Debugger) StepOut() error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+	depth := 0
+	for {
+		// step fails with errIllegalCall when ip is outside of the program
+		inst, _ := d.Instruction()
+		if err := d.step(); err != nil || d.finished {
+			return err
+		}
+		switch inst.OpCode {
+		case CALL:
+			depth++
+		case RET:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+		if d.breakpoints[d.vm.ip] {
+			return nil
+		}
+	}
+}
+
+func (d *Debugger) ready() error {
+	if !d.started {
+		return errDebuggerNotStarted
+	}
+	if d.finished {
+		return errDebuggerFinished
+	}
+	return nil
+}
+
+func (d *Debugger) step() error {
+	err := executeNext(d.vm)
+	if err == stopToken {
+		d.finish(nil)
+		return nil
+	}
+	if err != nil {
+		err = d.vm.sourceError(err)
+		d.finish(err)
+	}
+	return err
+}
+
+func (d *Debugger) finish(err error) {
+	d.finished = true
+	d.err = err
+	d.vm.session = nil
+	if err != nil {
+		d.vm.state.RevertToSnapshot(d.snapshot)
+		d.vm.logs = nil
+	} else {
+		d.vm.state.Commit()
+	}
+	if d.vm.tracer != nil {
+		d.vm.tracer.CaptureEnd(d.vm.GasUsed(), err)
+	}
+}
+
+// Finished reports whether the program has stopped or failed
+func (d *Debugger) Finished() bool {
+	return d.finished
+}
+
+// Err returns the error the program failed with, it's nil while the program is running
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+// Result returns the result of the program so far
+func (d *Debugger) Result() Result {
+	return d.vm.result()
+}
+
+// IP returns the address of the next instruction
+func (d *Debugger) IP() int {
+	return d.vm.ip
+}
+
+// Instruction returns the next instruction. It returns false if ip is outside of the program
+func (d *Debugger) Instruction() (Instruction, bool) {
+	if d.vm.ip < 0 || d.vm.ip >= len(d.vm.program) {
+		return Instruction{}, false
+	}
+	return d.vm.program[d.vm.ip], true
+}
+
+// Location returns the source location of the next instruction if the program has source map
+func (d *Debugger) Location() (SourceLoc, bool) {
+	return d.vm.sourceMap.Loc(d.vm.ip)
+}
+
+// Stack returns a copy of the stack, the top is the last
+func (d *Debugger) Stack() []Word {
+	return slices.Clone(d.vm.stack[1 : d.vm.stackSize+1])
+}
+
+// Memory returns a copy of the allocated memory
+func (d *Debugger) Memory() []byte {
+	return slices.Clone(d.vm.memory.store[:d.vm.memory.size])
+}
+
+// ReadMemory returns a copy of memory range
+func (d *Debugger) ReadMemory(offset, size uint64) ([]byte, error) {
+	var w Word
+	addr, err := memoryOffset(w.SetUint64(offset), size)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.vm.memory.store[addr : addr+size]), nil
+}
+
+// Storage reads the key from version storage including not committed changes of the run
+func (d *Debugger) Storage(key common.Hash) common.Hash {
+	return d.vm.state.Get(key)
+}
+
+// Gas returns the gas left
+func (d *Debugger) Gas() uint64 {
+	return d.vm.gas
+}
@@ -0,0 +1,164 @@
+package eulvm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// 0: CALL 3, 1: DROP, 2: STOP, 3: PUSH 2, 4: SWAP 1, 5: RET
+var debugProgram = NewProgram([]Instruction{
+	{OpCode: CALL, Operand: *uint256.NewInt(3)},
+	{OpCode: DROP},
+	{OpCode: STOP},
+	{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+	{OpCode: SWAP, Operand: *uint256.NewInt(1)},
+	{OpCode: RET},
+}, nil)
+
+func Test_DebuggerStep(t *testing.T) {
+	d := New(debugProgram).Debugger()
+	assert.ErrorIs(t, d.Step(), errDebuggerNotStarted)
+
+	d.Start(nil, 10_000)
+	assert.Equal(t, 0, d.IP())
+	assert.NoError(t, d.Step())
+	assert.Equal(t, 3, d.IP())
+	assert.Equal(t, []Word{*uint256.NewInt(1)}, d.Stack())
+
+	inst, ok := d.Instruction()
+	assert.True(t, ok)
+	assert.Equal(t, PUSH, inst.OpCode)
+
+	// step out of the function right after RET
+	assert.NoError(t, d.StepOut())
+	assert.Equal(t, 1, d.IP())
+	assert.Equal(t, []Word{*uint256.NewInt(2)}, d.Stack())
+	assert.Less(t, d.Gas(), uint64(10_000))
+
+	assert.NoError(t, d.Continue())
+	assert.True(t, d.Finished())
+	assert.NoError(t, d.Err())
+	assert.ErrorIs(t, d.Step(), errDebuggerFinished)
+}
+
+func Test_DebuggerNoStop(t *testing.T) {
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+	}, nil)
+	d := New(prog).Debugger()
+	d.Start(nil, 10_000)
+	assert.NoError(t, d.Step())
+
+	_, ok := d.Instruction()
+	assert.False(t, ok)
+	assert.ErrorIs(t, d.StepOut(), errIllegalCall)
+	assert.True(t, d.Finished())
+}
+
+func Test_DebuggerBreakpoints(t *testing.T) {
+	d := New(debugProgram).Debugger()
+	d.SetBreakpoint(4)
+	d.SetBreakpoint(1)
+	assert.Equal(t, []int{1, 4}, d.Breakpoints())
+
+	d.Start(nil, 10_000)
+	assert.NoError(t, d.Continue())
+	assert.Equal(t, 4, d.IP())
+	// breakpoint in the function stops StepOut
+	d.Start(nil, 10_000)
+	d.ClearBreakpoint(1)
+	assert.NoError(t, d.Step())
+	assert.NoError(t, d.StepOut())
+	assert.Equal(t, 4, d.IP())
+	assert.NoError(t, d.Continue())
+	assert.True(t, d.Finished())
+}
+
+func Test_DebuggerState(t *testing.T) {
+	db := NewMemoryStateDB()
+	d := New(counterProgram).WithStateDB(db).Debugger()
+	d.Start(nil, 100_000)
+
+	key := common.Hash{31: 1}
+	// counter program stores the value with the 6th instruction
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, d.Step())
+	}
+	// the write is visible to the debugger before it gets committed
+	assert.Equal(t, common.Hash{31: 1}, d.Storage(key))
+	assert.Equal(t, common.Hash{}, db.Get(key))
+
+	assert.NoError(t, d.Continue())
+	assert.Equal(t, common.Hash{31: 1}, db.Get(key))
+
+	// restart in the middle of the session drops its write
+	d.Start(nil, 100_000)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, d.Step())
+	}
+	assert.Equal(t, common.Hash{31: 2}, d.Storage(key))
+	d.Start(nil, 100_000)
+	assert.NoError(t, d.Continue())
+	assert.Equal(t, common.Hash{31: 2}, db.Get(key))
+
+	// failed program reverts the state
+	failing := NewProgram(counterProgram.Instrutions[:len(counterProgram.Instrutions)-1], nil)
+	d = New(failing).WithStateDB(db).Debugger()
+	d.Start(nil, 100_000)
+	assert.ErrorIs(t, d.Continue(), errIllegalCall)
+	assert.ErrorIs(t, d.Err(), errIllegalCall)
+	assert.Equal(t, common.Hash{31: 2}, db.Get(key))
+
+	mem, err := d.ReadMemory(0, 4)
+	assert.NoError(t, err)
+	assert.Len(t, mem, 4)
+	_, err = d.ReadMemory(MemoryCapacity, 1)
+	assert.ErrorIs(t, err, errInvalidMemoryAccess)
+}
+
+func Test_DebuggerREPL(t *testing.T) {
+	d := New(debugProgram).Debugger()
+	d.Start(nil, 10_000)
+
+	var out bytes.Buffer
+	err := d.REPL(strings.NewReader("b 4\nc\nstack\n\nout\nbreakpoints\nc\n"), &out)
+	assert.NoError(t, err)
+	assert.True(t, d.Finished())
+	assert.Equal(t, `ip: 0 -->call: CALL operand: 3
+ip: 4 -->call: SWAP operand: 1
+stack size: 2
+1: 0x2
+0: 0x1
+ip: 5 -->call: RET operand: 0
+ip: 1 -->call: DROP operand: 0
+breakpoints: [4]
+program finished
+`, out.String())
+}
+
+func Test_DebuggerQuit(t *testing.T) {
+	db := NewMemoryStateDB()
+	e := New(counterProgram).WithStateDB(db)
+	d := e.Debugger()
+	d.Start(nil, 100_000)
+
+	// counter program stores the value with the 6th instruction
+	err := d.REPL(strings.NewReader(strings.Repeat("s\n", 6)), &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.False(t, d.Finished())
+	_, err = e.Run(nil, 100_000)
+	assert.ErrorIs(t, err, errDebugSessionOpen)
+
+	err = d.REPL(strings.NewReader("q\n"), &bytes.Buffer{})
+	assert.ErrorIs(t, err, errDebuggerStopped)
+	assert.True(t, d.Finished())
+
+	_, err = e.Run(nil, 100_000)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Hash{31: 1}, db.Get(common.Hash{31: 1}))
+}
@@ -0,0 +1,136 @@
+package eulvm
+
+import "fmt"
+
+// GasSchedule holds the gas cost charged for executing each opcode.
+// Opcodes missing from the schedule are free.
+type GasSchedule [256]uint64
+
+// DefaultGasSchedule is used by the vm unless another schedule was set with WithGasSchedule
+var DefaultGasSchedule = GasSchedule{
+	STOP:   0,
+	RETURN: 3,
+	REVERT: 3,
+	NOP:    1,
+
+	// stack
+	PUSH: 3,
+	DUP:  3,
+	SWAP: 3,
+	DROP: 2,
+
+	// arithmetic and comparison
+	ADD:        3,
+	SUB:        3,
+	MUL:        5,
+	DIV:        5,
+	MOD:        5,
+	SDIV:       5,
+	SMOD:       5,
+	SIGNEXTEND: 5,
+	LT:         3,
+	GT:         3,
+	EQ:         3,
+	NEQ:        3,
+	SLT:        3,
+	SGT:        3,
+	NOT:        3,
+	AND:        3,
+	OR:         3,
+	XOR:        3,
+	BNOT:       3,
+	SHL:        3,
+	SHR:        3,
+	SAR:        3,
+
+	// control flow
+	JUMPDEST: 8,
+	JUMPI:    10,
+	CALL:     10,
+	RET:      8,
+	CALLDATA: 10,
+	DATALOAD: 3,
+
+	// memory
+	MSTORE8:   3,
+	MSTORE256: 3,
+	MLOAD:     3,
+	MLOAD256:  3,
+
+	// debug and natives
+	PRINT:    3,
+	INPUT:    3,
+	WRITESTR: 3,
+	NATIVE:   100,
+
+	// version storage
+	VSSTORE:    5000,
+	VSLOAD:     800,
+	MAPVSSTORE: 5030, // same as VSSTORE plus keccak of the map key
+	MAPVSSLOAD: 830,  // same as VSLOAD plus keccak of the map key
+	LOG:        375,  // plus LogTopicGas and LogDataGas
+
+	// execution context
+	CALLER:    2,
+	ORIGIN:    2,
+	NUMBER:    2,
+	TIMESTAMP: 2,
+	CHAINID:   2,
+
+	// contracts
+	EXTCALL: 700, // plus the gas used by the callee
+}
+
+// LOG cost depends on its size, these parts are charged on top of the schedule
+const (
+	LogTopicGas uint64 = 375
+	LogDataGas  uint64 = 8 // per byte of data
+)
+
+// Cost returns the gas cost of the opcode
+func (s *GasSchedule) Cost(op OpCode) uint64 {
+	return s[op]
+}
+
+// OutOfGasError is returned by Run when execution requires more gas than the limit
+type OutOfGasError struct {
+	GasLimit uint64
+	GasUsed  uint64
+
+	IP     int
+	OpCode OpCode
+}
+
+func (err *OutOfGasError) Error() string {
+	return fmt.Sprintf("out of gas: used %d of %d at ip %d (%s)", err.GasUsed, err.GasLimit, err.IP, OpCodes[err.OpCode])
+}
+
+// useGas charges the cost of the opcode. It returns false if there is not enough gas left
+func (e *EulVM) useGas(op OpCode) bool {
+	cost := e.gasTable.Cost(op)
+	if e.gas < cost {
+		return false
+	}
+	e.gas -= cost
+	return true
+}
+
+// useDynamicGas charges the cost which depends on operands of the current instruction
+func (e *EulVM) useDynamicGas(cost uint64) error {
+	if e.gas < cost {
+		return e.outOfGas()
+	}
+	e.gas -= cost
+	return nil
+}
+
+func (e *EulVM) outOfGas() error {
+	used := e.gasLimit - e.gas
+	e.gas = 0
+	return &OutOfGasError{
+		GasLimit: e.gasLimit,
+		GasUsed:  used,
+		IP:       e.ip,
+		OpCode:   e.program[e.ip].OpCode,
+	}
+}
@@ -0,0 +1,166 @@
+package eulvm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxCallDepth limits nesting of EXTCALL
+const MaxCallDepth = 64
+
+var (
+	errContractExists    = errors.New("contract is already deployed at the address")
+	errNoContract        = errors.New("no contract deployed at the address")
+	errNoHost            = errors.New("program isn't deployed to a host")
+	errCallDepthExceeded = errors.New("max call depth exceeded")
+	errInvalidAddress    = errors.New("contract address is wider than 160 bits")
+)
+
+type contract struct {
+	prog  Program
+	state *JournaledState
+}
+
+// Host keeps contracts deployed at addresses. Every contract has its own storage.
+// Contracts call each other with EXTCALL, failure of any call fails the whole host call
+type Host struct {
+	contracts map[common.Address]*contract
+
+	natives  *NativeRegistry
+	out      io.Writer
+	gasTable *GasSchedule
+}
+
+func NewHost() *Host {
+	return &Host{
+		contracts: make(map[common.Address]*contract),
+		out:       os.Stdout,
+		gasTable:  &DefaultGasSchedule,
+	}
+}
+
+// WithNatives sets registry of host natives which can be called by deployed contracts
+func (h *Host) WithNatives(natives *NativeRegistry) *Host {
+	h.natives = natives
+	return h
+}
+
+// WithOutput sets the writer for write and writef output of all contracts
+func (h *Host) WithOutput(w io.Writer) *Host {
+	h.out = w
+	return h
+}
+
+// WithGasSchedule replaces default opcode costs for all contracts
+func (h *Host) WithGasSchedule(schedule *GasSchedule) *Host {
+	h.gasTable = schedule
+	return h
+}
+
+// Deploy verifies the program and deploys it at the address with empty storage in memory
+func (h *Host) Deploy(addr common.Address, prog Program) error {
+	return h.DeployWithStateDB(addr, prog, NewMemoryStateDB())
+}
+
+// DeployWithStateDB deploys the program at the address with the given storage backend
+func (h *Host) DeployWithStateDB(addr common.Address, prog Program, db StateDB) error {
+	if _, ok := h.contracts[addr]; ok {
+		return fmt.Errorf("%s: %w", addr.Hex(), errContractExists)
+	}
+	if err := verifyProgram(prog, h.natives); err != nil {
+		return err
+	}
+	h.contracts[addr] = &contract{
+		prog:  prog,
+		state: NewJournaledState(db),
+	}
+	return nil
+}
+
+// StateDB returns the storage backend of the contract
+func (h *Host) StateDB(addr common.Address) (StateDB, bool) {
+	c, ok := h.contracts[addr]
+	if !ok {
+		return nil, false
+	}
+	return c.state.db, true
+}
+
+// Call runs the contract at the address. ctx.Caller is the account making the call.
+// State changes of all contracts are committed only if the call succeeds
+func (h *Host) Call(ctx Context, to common.Address, input []byte, gasLimit uint64) (Result, error) {
+	e, err := h.frame(to, ctx, 0)
+	if err != nil {
+		return Result{GasLeft: gasLimit}, err
+	}
+
+	snapshots := make(map[common.Address]int, len(h.contracts))
+	for addr, c := range h.contracts {
+		snapshots[addr] = c.state.Snapshot()
+	}
+	err = e.run(input, gasLimit)
+	for addr, c := range h.contracts {
+		if err != nil {
+			c.state.RevertToSnapshot(snapshots[addr])
+		} else {
+			c.state.Commit()
+		}
+	}
+	return e.result(), err
+}
+
+// frame creates vm executing the contract at the address
+func (h *Host) frame(addr common.Address, ctx Context, depth int) (*EulVM, error) {
+	c, ok := h.contracts[addr]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", addr.Hex(), errNoContract)
+	}
+	e := New(c.prog).WithNatives(h.natives).WithOutput(h.out).WithGasSchedule(h.gasTable).WithContext(ctx)
+	e.state = c.state
+	e.host = h
+	e.address = addr
+	e.depth = depth
+	return e, nil
+}
+
+// execExtCall pops input memory range and address of the contract, runs it with the gas left
+// and pushes the first word of its return data. Errors of the callee fail the caller
+func (e *EulVM) execExtCall() error {
+	if e.host == nil {
+		return errNoHost
+	}
+	if e.depth >= MaxCallDepth {
+		return errCallDepthExceeded
+	}
+	input, err := e.popMemoryRange()
+	if err != nil {
+		return err
+	}
+	if !NativeAddress.valid(&e.stack[e.stackSize]) {
+		return errInvalidAddress
+	}
+	to := common.BytesToAddress(e.stack[e.stackSize].Bytes())
+
+	ctx := e.ctx
+	ctx.Caller = e.address
+	callee, err := e.host.frame(to, ctx, e.depth+1)
+	if err != nil {
+		return err
+	}
+	err = callee.run(input, e.gas)
+	e.gas = callee.gas
+	e.output = append(e.output, callee.output...)
+	if err != nil {
+		return fmt.Errorf("call to %s: %w", to.Hex(), err)
+	}
+	e.logs = append(e.logs, callee.logs...)
+
+	var ret [32]byte
+	copy(ret[:], callee.returnData)
+	e.stack[e.stackSize].SetBytes32(ret[:])
+	return nil
+}
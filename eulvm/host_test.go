@@ -0,0 +1,109 @@
+package eulvm
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+// extCallProgram stores 1 under key 1, then calls the contract at addr
+func extCallProgram(addr common.Address) Program {
+	return NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: VSSTORE},
+		{OpCode: PUSH, Operand: *new(uint256.Int).SetBytes(addr.Bytes())},
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: EXTCALL},
+		{OpCode: DROP},
+		{OpCode: STOP},
+	}, nil)
+}
+
+// callerProgram stores its caller under key 2 and returns it, it reverts if the caller is the zero address
+var callerProgram = NewProgram([]Instruction{
+	{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+	{OpCode: CALLER},
+	{OpCode: VSSTORE},
+	{OpCode: CALLER},
+	{OpCode: JUMPI, Operand: *uint256.NewInt(8)},
+	{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+	{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+	{OpCode: REVERT},
+	{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+	{OpCode: CALLER},
+	{OpCode: MSTORE256},
+	{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+	{OpCode: PUSH, Operand: *uint256.NewInt(32)},
+	{OpCode: RETURN},
+}, nil)
+
+func Test_HostCall(t *testing.T) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	host := NewHost().WithOutput(io.Discard)
+	assert.NoError(t, host.Deploy(a, extCallProgram(b)))
+	assert.NoError(t, host.Deploy(b, callerProgram))
+	assert.ErrorIs(t, host.Deploy(b, callerProgram), errContractExists)
+
+	_, err := host.Call(Context{}, a, nil, 100_000)
+	assert.NoError(t, err)
+
+	dbA, _ := host.StateDB(a)
+	dbB, _ := host.StateDB(b)
+	assert.Equal(t, common.Hash{31: 1}, dbA.Get(common.Hash{31: 1}))
+	assert.Equal(t, common.BytesToHash(a.Bytes()), dbB.Get(common.Hash{31: 2}))
+
+	// b reverts when it's called directly by the zero address, nothing gets stored
+	res, err := host.Call(Context{}, b, nil, 100_000)
+	var rerr *RevertError
+	assert.True(t, errors.As(err, &rerr))
+	assert.Nil(t, res.ReturnData)
+	assert.Equal(t, common.BytesToHash(a.Bytes()), dbB.Get(common.Hash{31: 2}))
+
+	_, err = host.Call(Context{}, common.HexToAddress("0x0c"), nil, 100_000)
+	assert.ErrorIs(t, err, errNoContract)
+
+	// address word with bits above 160 doesn't get truncated to b
+	c := common.HexToAddress("0x0c")
+	wide := extCallProgram(b)
+	high := new(uint256.Int).Lsh(uint256.NewInt(1), 160)
+	wide.Instrutions[3].Operand.Or(&wide.Instrutions[3].Operand, high)
+	assert.NoError(t, host.Deploy(c, wide))
+	_, err = host.Call(Context{}, c, nil, 100_000)
+	assert.ErrorIs(t, err, errInvalidAddress)
+}
+
+func Test_HostCallRevertsAllContracts(t *testing.T) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	host := NewHost().WithOutput(io.Discard)
+	assert.NoError(t, host.Deploy(a, extCallProgram(b)))
+	// b stores and calls a contract which doesn't exist
+	assert.NoError(t, host.Deploy(b, extCallProgram(common.HexToAddress("0x0c"))))
+
+	res, err := host.Call(Context{}, a, nil, 100_000)
+	assert.ErrorIs(t, err, errNoContract)
+	assert.NotZero(t, res.GasUsed)
+
+	for _, addr := range []common.Address{a, b} {
+		db, _ := host.StateDB(addr)
+		assert.Equal(t, 0, db.(*MemoryStateDB).Len())
+	}
+}
+
+func Test_HostCallDepth(t *testing.T) {
+	a := common.HexToAddress("0x0a")
+	host := NewHost().WithOutput(io.Discard)
+	assert.NoError(t, host.Deploy(a, extCallProgram(a)))
+
+	_, err := host.Call(Context{}, a, nil, 10_000_000)
+	assert.ErrorIs(t, err, errCallDepthExceeded)
+
+	// without host
+	_, err = New(extCallProgram(a)).Run(nil, 100_000)
+	assert.ErrorIs(t, err, errNoHost)
+}
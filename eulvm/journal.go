@@ -0,0 +1,101 @@
+package eulvm
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// journalEntry keeps the value the key had in dirty storage before it was changed
+type journalEntry struct {
+	key     common.Hash
+	prev    common.Hash
+	hadPrev bool // false if the key wasn't dirty before the change
+}
+
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// JournaledState buffers writes on top of StateDB and keeps a journal of them,
+// so the changes can be reverted to any snapshot taken earlier.
+// Backend StateDB sees only the changes passed to Commit
+type JournaledState struct {
+	db StateDB
+
+	dirty   map[common.Hash]common.Hash
+	journal []journalEntry
+
+	validRevisions []revision
+	nextRevisionID int
+}
+
+func NewJournaledState(db StateDB) *JournaledState {
+	return &JournaledState{
+		db:    db,
+		dirty: make(map[common.Hash]common.Hash),
+	}
+}
+
+func (s *JournaledState) Get(key common.Hash) common.Hash {
+	if val, ok := s.dirty[key]; ok {
+		return val
+	}
+	return s.db.Get(key)
+}
+
+func (s *JournaledState) Set(key common.Hash, value common.Hash) {
+	prev, ok := s.dirty[key]
+	s.journal = append(s.journal, journalEntry{
+		key:     key,
+		prev:    prev,
+		hadPrev: ok,
+	})
+	s.dirty[key] = value
+}
+
+// Snapshot returns an identifier of the current state. Snapshots can be nested
+func (s *JournaledState) Snapshot() int {
+	id := s.nextRevisionID
+	s.nextRevisionID++
+	s.validRevisions = append(s.validRevisions, revision{id, len(s.journal)})
+	return id
+}
+
+// RevertToSnapshot undoes all the changes made after the snapshot was taken.
+// Snapshots taken after the given one become invalid
+func (s *JournaledState) RevertToSnapshot(id int) {
+	idx := -1
+	for i, rev := range s.validRevisions {
+		if rev.id == id {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		panic(fmt.Sprintf("revision id %d cannot be reverted", id))
+	}
+
+	journalIndex := s.validRevisions[idx].journalIndex
+	for i := len(s.journal) - 1; i >= journalIndex; i-- {
+		entry := s.journal[i]
+		if entry.hadPrev {
+			s.dirty[entry.key] = entry.prev
+		} else {
+			delete(s.dirty, entry.key)
+		}
+	}
+	s.journal = s.journal[:journalIndex]
+	s.validRevisions = s.validRevisions[:idx]
+}
+
+// Commit writes all the buffered changes into the backend StateDB and clears the journal
+func (s *JournaledState) Commit() {
+	for key, val := range s.dirty {
+		s.db.Set(key, val)
+	}
+	clear(s.dirty)
+	s.journal = s.journal[:0]
+	s.validRevisions = s.validRevisions[:0]
+}
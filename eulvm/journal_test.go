@@ -0,0 +1,46 @@
+package eulvm
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JournaledStateRevert(t *testing.T) {
+	db := NewMemoryStateDB()
+	key := common.HexToHash("0x01")
+	db.Set(key, common.HexToHash("0x0a"))
+
+	s := NewJournaledState(db)
+
+	outer := s.Snapshot()
+	s.Set(key, common.HexToHash("0x0b"))
+
+	inner := s.Snapshot()
+	s.Set(key, common.HexToHash("0x0c"))
+	s.Set(common.HexToHash("0x02"), common.HexToHash("0x0d"))
+	assert.Equal(t, common.HexToHash("0x0c"), s.Get(key))
+
+	s.RevertToSnapshot(inner)
+	assert.Equal(t, common.HexToHash("0x0b"), s.Get(key))
+	assert.Equal(t, common.Hash{}, s.Get(common.HexToHash("0x02")))
+
+	s.RevertToSnapshot(outer)
+	assert.Equal(t, common.HexToHash("0x0a"), s.Get(key))
+
+	// backend isn't touched until commit
+	s.Set(key, common.HexToHash("0x0e"))
+	assert.Equal(t, common.HexToHash("0x0a"), db.Get(key))
+	s.Commit()
+	assert.Equal(t, common.HexToHash("0x0e"), db.Get(key))
+}
+
+func Test_JournaledStateInvalidRevision(t *testing.T) {
+	s := NewJournaledState(NewMemoryStateDB())
+	outer := s.Snapshot()
+	inner := s.Snapshot()
+	s.RevertToSnapshot(outer)
+
+	assert.Panics(t, func() { s.RevertToSnapshot(inner) })
+}
@@ -0,0 +1,44 @@
+package eulvm
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxLogTopics is the maximum amount of topics LOG can take
+const MaxLogTopics = 4
+
+// Log is emitted by LOG opcode. Compiler puts the hash of event signature into the first topic
+type Log struct {
+	Topics []common.Hash
+	Data   []byte
+}
+
+// execLog pops data memory range and topics. The first topic is the deepest one
+func (e *EulVM) execLog(topics Word) error {
+	if !topics.IsUint64() || topics.Uint64() > MaxLogTopics {
+		return errInvalidLogTopics
+	}
+	n := int(topics.Uint64())
+	if err := e.ensureStack(LOG, 2+n); err != nil {
+		return err
+	}
+
+	data, err := e.popMemoryRange()
+	if err != nil {
+		return err
+	}
+	if err := e.useDynamicGas(uint64(n)*LogTopicGas + uint64(len(data))*LogDataGas); err != nil {
+		return err
+	}
+	log := Log{
+		Topics: make([]common.Hash, n),
+		Data:   data,
+	}
+	for i := range log.Topics {
+		log.Topics[i] = e.stack[e.stackSize-n+1+i].Bytes32()
+	}
+	e.stackSize -= n
+
+	e.logs = append(e.logs, log)
+	return nil
+}
@@ -24,6 +24,21 @@ func NewMemoryWithPrealloc(prealloc []byte) *Memory {
 	return m
 }
 
+// reset clears the memory and fills it with prealloc
+func (m *Memory) reset(prealloc []byte) {
+	clear(m.store[:m.size])
+	copy(m.store[:], prealloc)
+	m.size = uint64(len(prealloc))
+}
+
+// memoryOffset validates that size bytes starting from offset fit into the memory
+func memoryOffset(offset *Word, size uint64) (uint64, error) {
+	if size > MemoryCapacity || !offset.IsUint64() || offset.Uint64() > MemoryCapacity-size {
+		return 0, errInvalidMemoryAccess
+	}
+	return offset.Uint64(), nil
+}
+
 func (m *Memory) Set32(offset uint64, val uint256.Int) {
 	// length of store may never be less than offset + size.
 	// The store should be resized PRIOR to setting the memory
@@ -0,0 +1,84 @@
+package eulvm
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// Version storage is committed with a compact sparse merkle tree of depth 256.
+// Path of the leaf is the bits of its key (most significant bit first).
+//   - empty subtree hashes to zero hash
+//   - subtree with exactly one leaf hashes to keccak256(0x00 || key || value)
+//   - any other subtree hashes to keccak256(0x01 || left || right)
+//
+// Keys with zero values are considered empty, so the root depends only on values a contract can observe.
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// EmptyStateRoot is the root of the version storage without any keys
+var EmptyStateRoot = common.Hash{}
+
+// StateRooter is implemented by StateDB backends which can commit to their content with a state root
+type StateRooter interface {
+	Root() common.Hash
+}
+
+type merkleLeaf struct {
+	key common.Hash
+	val common.Hash
+}
+
+// MerkleRoot calculates the state root of the storage
+func MerkleRoot(storage map[common.Hash]common.Hash) common.Hash {
+	leaves := make([]merkleLeaf, 0, len(storage))
+	for key, val := range storage {
+		if val == (common.Hash{}) {
+			continue
+		}
+		leaves = append(leaves, merkleLeaf{key, val})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].key[:], leaves[j].key[:]) < 0
+	})
+
+	hasher := sha3.NewLegacyKeccak256().(keccakState)
+	return merkleSubtreeRoot(hasher, leaves, 0)
+}
+
+// leaves must be sorted and share the same first depth bits of the key
+func merkleSubtreeRoot(hasher keccakState, leaves []merkleLeaf, depth int) common.Hash {
+	var res common.Hash
+	switch len(leaves) {
+	case 0:
+		return res
+	case 1:
+		hasher.Reset()
+		hasher.Write([]byte{merkleLeafPrefix})
+		hasher.Write(leaves[0].key[:])
+		hasher.Write(leaves[0].val[:])
+		hasher.Read(res[:])
+		return res
+	}
+
+	split := sort.Search(len(leaves), func(i int) bool {
+		return keyBit(leaves[i].key, depth) == 1
+	})
+	left := merkleSubtreeRoot(hasher, leaves[:split], depth+1)
+	right := merkleSubtreeRoot(hasher, leaves[split:], depth+1)
+
+	hasher.Reset()
+	hasher.Write([]byte{merkleNodePrefix})
+	hasher.Write(left[:])
+	hasher.Write(right[:])
+	hasher.Read(res[:])
+	return res
+}
+
+func keyBit(key common.Hash, i int) byte {
+	return (key[i/8] >> (7 - i%8)) & 1
+}
@@ -0,0 +1,29 @@
+package eulvm
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MerkleRoot(t *testing.T) {
+	assert.Equal(t, EmptyStateRoot, MerkleRoot(nil))
+
+	a, b := NewMemoryStateDB(), NewMemoryStateDB()
+	for i := 1; i <= 50; i++ {
+		a.Set(common.BytesToHash([]byte{byte(i * 5)}), common.HexToHash("0x01"))
+	}
+	for i := 50; i >= 1; i-- {
+		b.Set(common.BytesToHash([]byte{byte(i * 5)}), common.HexToHash("0x01"))
+	}
+	assert.Equal(t, a.Root(), b.Root())
+	assert.NotEqual(t, EmptyStateRoot, a.Root())
+
+	// zero values are the same as missing keys
+	b.Set(common.HexToHash("0xff"), common.Hash{})
+	assert.Equal(t, a.Root(), b.Root())
+
+	b.Set(common.HexToHash("0x02"), common.HexToHash("0x02"))
+	assert.NotEqual(t, a.Root(), b.Root())
+}
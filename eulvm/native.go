@@ -0,0 +1,213 @@
+package eulvm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"golang.org/x/crypto/sha3"
+)
+
+// NativeType is the type of host native param or result. Values are passed as words the same way eulang keeps them on the stack
+type NativeType uint8
+
+const (
+	NativeVoid    NativeType = iota // only allowed as a result
+	NativeI64                       // sign extended int64
+	NativeBool                      // 0 or 1
+	NativeBytes32                   // any word
+	NativeAddress                   // word with 20 significant bytes
+)
+
+var nativeTypeNames = map[NativeType]string{
+	NativeVoid:    "void",
+	NativeI64:     "i64",
+	NativeBool:    "bool",
+	NativeBytes32: "bytes32",
+	NativeAddress: "address",
+}
+
+func (t NativeType) String() string {
+	if name, ok := nativeTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("NativeType(%d)", uint8(t))
+}
+
+// valid checks that the word is a correct value of the type
+func (t NativeType) valid(w *Word) bool {
+	switch t {
+	case NativeI64:
+		var ext Word
+		return ext.ExtendSign(w, &i64SignByte).Eq(w)
+	case NativeBool:
+		return w.IsZero() || w.Eq(&wordOne)
+	case NativeAddress:
+		return w.BitLen() <= 160
+	}
+	return true
+}
+
+var (
+	i64SignByte = *uint256.NewInt(7)
+	wordOne     = *uint256.NewInt(1)
+)
+
+// NativeSignature is the typed signature of a host native
+type NativeSignature struct {
+	Params  []NativeType
+	Returns NativeType
+}
+
+func (sig NativeSignature) String() string {
+	s := "("
+	for i, p := range sig.Params {
+		if i > 0 {
+			s += ", "
+		}
+		s += p.String()
+	}
+	return s + ") " + sig.Returns.String()
+}
+
+// NativeFunc is the go callback of a host native. args are in the order of declaration.
+// Returned error aborts the execution. Result of void natives is ignored
+type NativeFunc func(args []Word) (Word, error)
+
+// HostNative is the native function registered by the embedding program
+type HostNative struct {
+	ID   uint64
+	Name string
+	Sig  NativeSignature
+	Fn   NativeFunc
+}
+
+// host native ids have this bit set so they never clash with builtin natives
+const hostNativeFlag uint64 = 1 << 32
+
+// HostNativeID returns the id NATIVE opcode uses to call host native with the name.
+// It depends on the name only so programs can be compiled and run by different hosts
+func HostNativeID(name string) uint64 {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(name))
+	return hostNativeFlag | uint64(binary.BigEndian.Uint32(h.Sum(nil)))
+}
+
+var (
+	errNativeNameTaken  = errors.New("native with this name is already registered")
+	errNativeIDTaken    = errors.New("native id clashes with registered native")
+	errNativeBadSig     = errors.New("invalid native signature")
+	errNativeNilFunc    = errors.New("native function is nil")
+	errNativeBadResult  = errors.New("native returned value of wrong type")
+	errNativeNoRegistry = errors.New("host natives are not registered")
+)
+
+// NativeRegistry holds host natives. It's shared by compiler for type checking of extern funcs and vm for calling them
+type NativeRegistry struct {
+	natives map[uint64]*HostNative
+	names   map[string]uint64
+}
+
+func NewNativeRegistry() *NativeRegistry {
+	return &NativeRegistry{
+		natives: make(map[uint64]*HostNative),
+		names:   make(map[string]uint64),
+	}
+}
+
+// Register adds the native and returns its id
+func (r *NativeRegistry) Register(name string, sig NativeSignature, fn NativeFunc) (uint64, error) {
+	if fn == nil {
+		return 0, fmt.Errorf("%s: %w", name, errNativeNilFunc)
+	}
+	if _, ok := r.names[name]; ok {
+		return 0, fmt.Errorf("%s: %w", name, errNativeNameTaken)
+	}
+	for _, p := range sig.Params {
+		if p == NativeVoid || p > NativeAddress {
+			return 0, fmt.Errorf("%s: %w: param type %s", name, errNativeBadSig, p)
+		}
+	}
+	if sig.Returns > NativeAddress {
+		return 0, fmt.Errorf("%s: %w: result type %s", name, errNativeBadSig, sig.Returns)
+	}
+	if len(sig.Params) > maxStackSize {
+		return 0, fmt.Errorf("%s: %w: too many params", name, errNativeBadSig)
+	}
+
+	id := HostNativeID(name)
+	if clash, ok := r.natives[id]; ok {
+		return 0, fmt.Errorf("%s: %w %s", name, errNativeIDTaken, clash.Name)
+	}
+
+	r.natives[id] = &HostNative{
+		ID:   id,
+		Name: name,
+		Sig:  NativeSignature{Params: append([]NativeType(nil), sig.Params...), Returns: sig.Returns},
+		Fn:   fn,
+	}
+	r.names[name] = id
+	return id, nil
+}
+
+// Lookup finds the native by name
+func (r *NativeRegistry) Lookup(name string) (*HostNative, bool) {
+	if r == nil {
+		return nil, false
+	}
+	id, ok := r.names[name]
+	if !ok {
+		return nil, false
+	}
+	return r.natives[id], true
+}
+
+func (r *NativeRegistry) byID(id uint64) (*HostNative, bool) {
+	if r == nil {
+		return nil, false
+	}
+	native, ok := r.natives[id]
+	return native, ok
+}
+
+// execHostNative pops args of the native and pushes its result if it isn't void
+func (e *EulVM) execHostNative(id uint64) error {
+	native, ok := e.natives.byID(id)
+	if !ok {
+		if e.natives == nil {
+			return errNativeNoRegistry
+		}
+		return errUnknownNative
+	}
+
+	argc := len(native.Sig.Params)
+	if err := e.ensureStack(NATIVE, argc); err != nil {
+		return err
+	}
+	args := make([]Word, argc)
+	copy(args, e.stack[e.stackSize-argc+1:e.stackSize+1])
+	e.stackSize -= argc
+
+	res, err := native.Fn(args)
+	if err != nil {
+		return fmt.Errorf("native %s: %w", native.Name, err)
+	}
+	if native.Sig.Returns == NativeVoid {
+		return nil
+	}
+	if !native.Sig.Returns.valid(&res) {
+		return fmt.Errorf("native %s: %w %s", native.Name, errNativeBadResult, native.Sig.Returns)
+	}
+	if e.stackSize >= maxStackSize {
+		return &StackOverflowError{
+			IP:        e.ip,
+			OpCode:    NATIVE,
+			StackSize: e.stackSize,
+			Limit:     maxStackSize,
+		}
+	}
+	e.stackSize++
+	e.stack[e.stackSize] = res
+	return nil
+}
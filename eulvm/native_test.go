@@ -0,0 +1,88 @@
+package eulvm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NativeRegistry(t *testing.T) {
+	r := NewNativeRegistry()
+	sig := NativeSignature{Params: []NativeType{NativeI64, NativeI64}, Returns: NativeI64}
+	add := func(args []Word) (Word, error) {
+		var res Word
+		return *res.Add(&args[0], &args[1]), nil
+	}
+
+	id, err := r.Register("add", sig, add)
+	assert.NoError(t, err)
+	assert.Equal(t, HostNativeID("add"), id)
+	assert.False(t, isKnownNative(id))
+
+	native, ok := r.Lookup("add")
+	assert.True(t, ok)
+	assert.Equal(t, sig, native.Sig)
+
+	_, err = r.Register("add", sig, add)
+	assert.ErrorIs(t, err, errNativeNameTaken)
+	_, err = r.Register("void_param", NativeSignature{Params: []NativeType{NativeVoid}}, add)
+	assert.ErrorIs(t, err, errNativeBadSig)
+	_, err = r.Register("nil", sig, nil)
+	assert.ErrorIs(t, err, errNativeNilFunc)
+}
+
+func Test_RunHostNative(t *testing.T) {
+	r := NewNativeRegistry()
+	var logged []Word
+	_, err := r.Register("log", NativeSignature{Params: []NativeType{NativeI64}}, func(args []Word) (Word, error) {
+		logged = append(logged, args[0])
+		return Word{}, nil
+	})
+	assert.NoError(t, err)
+	_, err = r.Register("sub", NativeSignature{Params: []NativeType{NativeI64, NativeI64}, Returns: NativeI64}, func(args []Word) (Word, error) {
+		var res Word
+		return *res.Sub(&args[0], &args[1]), nil
+	})
+	assert.NoError(t, err)
+	errHost := errors.New("host failure")
+	_, err = r.Register("fail", NativeSignature{Returns: NativeBool}, func(args []Word) (Word, error) {
+		return Word{}, errHost
+	})
+	assert.NoError(t, err)
+	_, err = r.Register("bad_bool", NativeSignature{Returns: NativeBool}, func(args []Word) (Word, error) {
+		return *uint256.NewInt(2), nil
+	})
+	assert.NoError(t, err)
+
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(10)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(3)},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(HostNativeID("sub"))},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(HostNativeID("log"))},
+		{OpCode: STOP},
+	}, nil)
+
+	// host natives are unknown without registry
+	_, err = NewVerified(prog)
+	assert.Error(t, err)
+
+	e := New(prog).WithNatives(r)
+	assert.NoError(t, e.Verify())
+	_, err = e.Run(nil, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, []Word{*uint256.NewInt(7)}, logged)
+	assert.Equal(t, 0, e.stackSize)
+
+	call := func(name string) error {
+		_, err := New(NewProgram([]Instruction{
+			{OpCode: NATIVE, Operand: *uint256.NewInt(HostNativeID(name))},
+			{OpCode: STOP},
+		}, nil)).WithNatives(r).Run(nil, 1000)
+		return err
+	}
+	assert.ErrorIs(t, call("fail"), errHost)
+	assert.ErrorIs(t, call("bad_bool"), errNativeBadResult)
+	assert.ErrorIs(t, call("missing"), errUnknownNative)
+}
@@ -7,7 +7,7 @@ const (
 	STOP OpCode = iota
 	ADD
 	SUB
-	POP
+	POP // reserved, not implemented. DROP removes the top of the stack
 	PUSH
 	SWAP
 	DUP
@@ -22,9 +22,22 @@ const (
 	CALL
 	CALLDATA
 	DATALOAD
+	MUL
+	DIV // division by zero results in zero
+	MOD // modulo by zero results in zero
+
+	// signed ops treat words as two's complement numbers
+	SDIV       // division by zero results in zero
+	SMOD       // modulo by zero results in zero, sign follows the dividend
+	SIGNEXTEND // extends sign bit of the byte with index operand (0 is the least significant byte)
+
+	RETURN // stops execution and hands memory range (address and size on top) to the host
+	REVERT // aborts execution with the reason from memory range (address and size on top). State changes are discarded
 )
 
-// 0x10 range - comparison ops.
+// 0x10 range - comparison and bitwise ops.
+// Shifts take the shift amount from the top of the stack, shifting by 256 or more bits
+// results in zero (or all sign bits for SAR)
 const (
 	LT OpCode = iota + 0x20
 	GT
@@ -33,6 +46,13 @@ const (
 	NEQ
 	AND
 	OR
+	SLT
+	SGT
+	XOR
+	BNOT // bitwise not, NOT is logical
+	SHL
+	SHR
+	SAR // arithmetic shift right
 )
 
 // 0x20 - debug
@@ -50,6 +70,21 @@ const (
 	VSLOAD                          // load var from version storage
 	MAPVSSTORE                      // store map key into version storage
 	MAPVSSLOAD                      // load map key from version storage
+	LOG                             // emits log with data from memory range (address and size on top) and operand amount of topics under it
+)
+
+// 0x50 - execution context
+const (
+	CALLER    OpCode = iota + 0x50 // pushes address of the caller
+	ORIGIN                         // pushes address of the transaction origin
+	NUMBER                         // pushes block number
+	TIMESTAMP                      // pushes block timestamp
+	CHAINID                        // pushes chain id
+)
+
+// 0x60 - contracts
+const (
+	EXTCALL OpCode = iota + 0x60 // calls contract at address with input from memory range (address and size on top), pushes first word of its return data
 )
 
 var OpCodesView = map[string]OpCode{
@@ -80,10 +115,33 @@ var OpCodesView = map[string]OpCode{
 	"NEQ":        NEQ,
 	"AND":        AND,
 	"OR":         OR,
+	"CALL":       CALL,
+	"MUL":        MUL,
+	"DIV":        DIV,
+	"MOD":        MOD,
+	"SDIV":       SDIV,
+	"SMOD":       SMOD,
+	"SIGNEXTEND": SIGNEXTEND,
+	"SLT":        SLT,
+	"SGT":        SGT,
+	"XOR":        XOR,
+	"BNOT":       BNOT,
+	"SHL":        SHL,
+	"SHR":        SHR,
+	"SAR":        SAR,
+	"RETURN":     RETURN,
+	"REVERT":     REVERT,
 	"VSSTORE":    VSSTORE,
 	"VSLOAD":     VSLOAD,
 	"MAPVSSTORE": MAPVSSTORE,
 	"MAPVSSLOAD": MAPVSSLOAD,
+	"LOG":        LOG,
+	"CALLER":     CALLER,
+	"ORIGIN":     ORIGIN,
+	"NUMBER":     NUMBER,
+	"TIMESTAMP":  TIMESTAMP,
+	"CHAINID":    CHAINID,
+	"EXTCALL":    EXTCALL,
 }
 
 var OpCodes = map[OpCode]string{
@@ -106,6 +164,21 @@ var OpCodes = map[OpCode]string{
 	LT:         "LT",
 	DROP:       "DROP",
 	CALL:       "CALL",
+	MUL:        "MUL",
+	DIV:        "DIV",
+	MOD:        "MOD",
+	SDIV:       "SDIV",
+	SMOD:       "SMOD",
+	SIGNEXTEND: "SIGNEXTEND",
+	SLT:        "SLT",
+	SGT:        "SGT",
+	XOR:        "XOR",
+	BNOT:       "BNOT",
+	SHL:        "SHL",
+	SHR:        "SHR",
+	SAR:        "SAR",
+	RETURN:     "RETURN",
+	REVERT:     "REVERT",
 	CALLDATA:   "CALLDATA",
 	DATALOAD:   "DATALOAD",
 	RET:        "RET",
@@ -115,10 +188,74 @@ var OpCodes = map[OpCode]string{
 	GT:         "GT",
 	AND:        "AND",
 	OR:         "OR",
-	VSSTORE:    "VSTORE",
-	VSLOAD:     "VLOAD",
+	VSSTORE:    "VSSTORE",
+	VSLOAD:     "VSLOAD",
 	MAPVSSTORE: "MAPVSSTORE",
 	MAPVSSLOAD: "MAPVSSLOAD",
+	LOG:        "LOG",
+	CALLER:     "CALLER",
+	ORIGIN:     "ORIGIN",
+	NUMBER:     "NUMBER",
+	TIMESTAMP:  "TIMESTAMP",
+	CHAINID:    "CHAINID",
+	EXTCALL:    "EXTCALL",
+}
+
+// stackEffect describes how the opcode changes the stack
+type stackEffect struct {
+	pops   int // words the opcode takes from the top of the stack
+	pushes int // words the opcode puts on the stack after the pops
+}
+
+// stackEffects are checked before every instruction gets executed.
+// SWAP and LOG depend on their operand and NATIVE depends on the called native, they're validated separately
+var stackEffects = [256]stackEffect{
+	ADD:        {2, 1},
+	SUB:        {2, 1},
+	MUL:        {2, 1},
+	DIV:        {2, 1},
+	MOD:        {2, 1},
+	SDIV:       {2, 1},
+	SMOD:       {2, 1},
+	SIGNEXTEND: {1, 1},
+	SLT:        {2, 1},
+	SGT:        {2, 1},
+	XOR:        {2, 1},
+	BNOT:       {1, 1},
+	SHL:        {2, 1},
+	SHR:        {2, 1},
+	SAR:        {2, 1},
+	RETURN:     {2, 0},
+	REVERT:     {2, 0},
+	PUSH:       {0, 1},
+	DUP:        {1, 2},
+	JUMPI:      {1, 0},
+	MSTORE256:  {2, 0},
+	MLOAD:      {1, 1},
+	DROP:       {1, 0},
+	RET:        {1, 0},
+	CALL:       {0, 1},
+	CALLDATA:   {0, 1},
+	DATALOAD:   {1, 1},
+	LT:         {2, 1},
+	GT:         {2, 1},
+	EQ:         {2, 1},
+	NOT:        {1, 1},
+	NEQ:        {2, 1},
+	AND:        {2, 1},
+	OR:         {2, 1},
+	INPUT:      {0, 1},
+	VSSTORE:    {2, 0},
+	VSLOAD:     {1, 1},
+	MAPVSSTORE: {2, 0},
+	MAPVSSLOAD: {1, 1},
+	LOG:        {2, 0}, // plus topics
+	CALLER:     {0, 1},
+	ORIGIN:     {0, 1},
+	NUMBER:     {0, 1},
+	TIMESTAMP:  {0, 1},
+	CHAINID:    {0, 1},
+	EXTCALL:    {3, 1},
 }
 
 func checkOpCodes() {}
@@ -7,6 +7,8 @@ type Program struct {
 	Instrutions []Instruction
 
 	PreallocMemory []byte
+
+	SourceMap SourceMap // optional, set by the compiler
 }
 
 func NewProgram(instrs []Instruction, preallocMemory []byte) Program {
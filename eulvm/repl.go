@@ -0,0 +1,124 @@
+package eulvm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const replHelp = `debugger commands:
+  step, s or ''    - execute next instruction
+  continue, c      - run until breakpoint or the end of the program
+  out, o           - run until the current function returns
+  break, b <ip>    - set breakpoint
+  clear <ip>       - remove breakpoint
+  breakpoints      - list breakpoints
+  stack            - dump current stack state
+  memory           - dump current memory state
+  storage <key>    - read version storage key
+  gas              - show gas left
+  quit, q          - stop debugging
+`
+
+// REPL reads debugger commands line by line from in until the program finishes or the input ends.
+// Debugger must be started. It returns the error of the program
+func (d *Debugger) REPL(in io.Reader, out io.Writer) error {
+	if err := d.ready(); err != nil {
+		return err
+	}
+
+	d.printNext(out)
+	scanner := bufio.NewScanner(in)
+	for !d.finished && scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		command := ""
+		if len(fields) > 0 {
+			command = fields[0]
+		}
+
+		switch command {
+		case "help":
+			fmt.Fprint(out, replHelp)
+		case "", "s", "step":
+			d.Step()
+			d.printNext(out)
+		case "c", "continue":
+			d.Continue()
+			d.printNext(out)
+		case "o", "out":
+			d.StepOut()
+			d.printNext(out)
+		case "b", "break", "clear":
+			ip, ok := replOperand(fields)
+			if !ok {
+				fmt.Fprintf(out, "%s expects instruction address\n", command)
+				continue
+			}
+			if command == "clear" {
+				d.ClearBreakpoint(ip)
+			} else {
+				d.SetBreakpoint(ip)
+			}
+		case "breakpoints":
+			fmt.Fprintln(out, "breakpoints:", d.Breakpoints())
+		case "stack":
+			stack := d.Stack()
+			fmt.Fprintln(out, "stack size:", len(stack))
+			for i := len(stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(out, "%d: %s\n", i, stack[i].Hex())
+			}
+		case "memory":
+			fmt.Fprintln(out, "allocated size:", d.vm.memory.size)
+			fmt.Fprintln(out, d.Memory())
+		case "storage":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "storage expects key")
+				continue
+			}
+			fmt.Fprintln(out, d.Storage(common.HexToHash(fields[1])).Hex())
+		case "gas":
+			fmt.Fprintln(out, "gas left:", d.Gas())
+		case "q", "quit":
+			d.Stop()
+			return d.err
+		default:
+			fmt.Fprintln(out, "use help to get commands info")
+		}
+	}
+
+	if d.finished {
+		if d.err != nil {
+			fmt.Fprintln(out, "program failed:", d.err)
+		} else {
+			fmt.Fprintln(out, "program finished")
+		}
+	}
+	return d.err
+}
+
+func (d *Debugger) printNext(out io.Writer) {
+	if d.finished {
+		return
+	}
+	inst, ok := d.Instruction()
+	if !ok {
+		fmt.Fprintln(out, "ip:", d.IP(), "is outside of the program")
+		return
+	}
+	if loc, ok := d.Location(); ok {
+		fmt.Fprintf(out, "%s (%s) ", loc, loc.Func)
+	}
+	fmt.Fprintln(out, "ip:", d.IP(), "-->call:", OpCodes[inst.OpCode], "operand:", inst.Operand.Dec())
+}
+
+func replOperand(fields []string) (int, bool) {
+	if len(fields) != 2 {
+		return 0, false
+	}
+	ip, err := strconv.Atoi(fields[1])
+	return ip, err == nil
+}
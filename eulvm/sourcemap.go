@@ -0,0 +1,55 @@
+package eulvm
+
+import "fmt"
+
+// SourceLoc is the location in eulang source the instruction was compiled from. Rows start from 1,
+// zero Row means the location is unknown
+type SourceLoc struct {
+	File string
+	Row  int
+	Col  int
+	Func string // function the instruction belongs to, empty for the code outside of functions
+}
+
+func (l SourceLoc) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Row, l.Col)
+}
+
+// SourceMap maps instruction addresses to source locations
+type SourceMap []SourceLoc
+
+// Loc returns the location of the instruction at ip
+func (m SourceMap) Loc(ip int) (SourceLoc, bool) {
+	if ip < 0 || ip >= len(m) || m[ip].Row == 0 {
+		return SourceLoc{}, false
+	}
+	return m[ip], true
+}
+
+// SourceError is returned by Run instead of the runtime error if the program has source location of the failed instruction
+type SourceError struct {
+	Loc SourceLoc
+	IP  int
+	Err error
+}
+
+func (err *SourceError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Loc, err.Err)
+}
+
+func (err *SourceError) Unwrap() error {
+	return err.Err
+}
+
+// sourceError attaches location of the current instruction to the error
+func (e *EulVM) sourceError(err error) error {
+	loc, ok := e.sourceMap.Loc(e.ip)
+	if !ok {
+		return err
+	}
+	return &SourceError{
+		Loc: loc,
+		IP:  e.ip,
+		Err: err,
+	}
+}
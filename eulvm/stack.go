@@ -45,3 +45,90 @@ func (st *Stack) Dump() {
 	}
 	fmt.Println("#############")
 }
+
+// StackUnderflowError is returned when the instruction requires more words than there are on the stack
+type StackUnderflowError struct {
+	IP     int
+	OpCode OpCode
+
+	StackSize int
+	Required  int
+}
+
+func (err *StackUnderflowError) Error() string {
+	return fmt.Sprintf("stack underflow at ip %d (%s): stack size %d, required %d",
+		err.IP, OpCodes[err.OpCode], err.StackSize, err.Required)
+}
+
+// StackOverflowError is returned when the instruction would grow the stack beyond StackCapacity
+type StackOverflowError struct {
+	IP     int
+	OpCode OpCode
+
+	StackSize int
+	Limit     int
+}
+
+func (err *StackOverflowError) Error() string {
+	return fmt.Sprintf("stack overflow at ip %d (%s): stack size %d, limit %d",
+		err.IP, OpCodes[err.OpCode], err.StackSize, err.Limit)
+}
+
+// InvalidSwapDepthError is returned when SWAP operand points below the bottom of the stack
+type InvalidSwapDepthError struct {
+	IP     int
+	OpCode OpCode
+
+	StackSize int
+	Depth     Word
+}
+
+func (err *InvalidSwapDepthError) Error() string {
+	return fmt.Sprintf("invalid swap depth at ip %d (%s): stack size %d, depth %s",
+		err.IP, OpCodes[err.OpCode], err.StackSize, err.Depth.Dec())
+}
+
+// maxStackSize is the amount of words that fit into vm stack. First slot of the stack is never used
+const maxStackSize = StackCapacity - 1
+
+// checkStack validates that the instruction can be executed on the current stack
+func (e *EulVM) checkStack(inst Instruction) error {
+	if inst.OpCode == SWAP {
+		if !inst.Operand.IsUint64() || inst.Operand.Uint64() >= uint64(e.stackSize) {
+			return &InvalidSwapDepthError{
+				IP:        e.ip,
+				OpCode:    inst.OpCode,
+				StackSize: e.stackSize,
+				Depth:     inst.Operand,
+			}
+		}
+		return nil
+	}
+
+	effect := stackEffects[inst.OpCode]
+	if err := e.ensureStack(inst.OpCode, effect.pops); err != nil {
+		return err
+	}
+	if e.stackSize-effect.pops+effect.pushes > maxStackSize {
+		return &StackOverflowError{
+			IP:        e.ip,
+			OpCode:    inst.OpCode,
+			StackSize: e.stackSize,
+			Limit:     maxStackSize,
+		}
+	}
+	return nil
+}
+
+// ensureStack validates that there are at least n words on the stack
+func (e *EulVM) ensureStack(op OpCode, n int) error {
+	if e.stackSize < n {
+		return &StackUnderflowError{
+			IP:        e.ip,
+			OpCode:    op,
+			StackSize: e.stackSize,
+			Required:  n,
+		}
+	}
+	return nil
+}
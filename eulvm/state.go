@@ -0,0 +1,58 @@
+package eulvm
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateDB is a backend for the version storage. VSSTORE/VSLOAD and MAPVSSTORE/MAPVSSLOAD
+// read and write through it. Reading a key that was never set must return an empty hash
+type StateDB interface {
+	Get(key common.Hash) common.Hash
+	Set(key common.Hash, value common.Hash)
+}
+
+// MemoryStateDB is an in-memory StateDB. It's used by default if no other StateDB was provided to the vm
+type MemoryStateDB struct {
+	storage map[common.Hash]common.Hash
+
+	root      common.Hash
+	rootValid bool // root is recalculated only after changes
+}
+
+func NewMemoryStateDB() *MemoryStateDB {
+	return &MemoryStateDB{
+		storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+func (db *MemoryStateDB) Get(key common.Hash) common.Hash {
+	return db.storage[key]
+}
+
+func (db *MemoryStateDB) Set(key common.Hash, value common.Hash) {
+	db.storage[key] = value
+	db.rootValid = false
+}
+
+// Root returns merkle root of the stored keys
+func (db *MemoryStateDB) Root() common.Hash {
+	if !db.rootValid {
+		db.root = MerkleRoot(db.storage)
+		db.rootValid = true
+	}
+	return db.root
+}
+
+// Len returns amount of stored keys
+func (db *MemoryStateDB) Len() int {
+	return len(db.storage)
+}
+
+// Copy returns a deep copy of the state
+func (db *MemoryStateDB) Copy() *MemoryStateDB {
+	cpy := NewMemoryStateDB()
+	for k, v := range db.storage {
+		cpy.storage[k] = v
+	}
+	return cpy
+}
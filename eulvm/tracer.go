@@ -0,0 +1,110 @@
+package eulvm
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tracer receives events of the vm execution. It can be set with WithTracer.
+// Slices passed to the tracer are valid only until the callback returns
+type Tracer interface {
+	// CaptureStep is called before execution of every instruction. gas is the amount of gas left before the instruction gets charged
+	CaptureStep(ip int, op OpCode, operand Word, stack []Word, gas uint64)
+	// CaptureNative is called before the native function gets executed
+	CaptureNative(ip int, id uint64)
+	// CaptureStateRead is called after the value gets loaded from version storage
+	CaptureStateRead(key common.Hash, value common.Hash)
+	// CaptureStateWrite is called after the value gets stored into version storage
+	CaptureStateWrite(key common.Hash, value common.Hash)
+	// CaptureEnd is called when run is finished. err is nil if the program stopped successfully
+	CaptureEnd(gasUsed uint64, err error)
+}
+
+// JSONTracer writes every event as a separate json line
+type JSONTracer struct {
+	encoder   *json.Encoder
+	sourceMap SourceMap
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// WithSourceMap adds source locations of instructions to step events
+func (t *JSONTracer) WithSourceMap(m SourceMap) *JSONTracer {
+	t.sourceMap = m
+	return t
+}
+
+type jsonTraceEvent struct {
+	Event   string   `json:"event"`
+	IP      *int     `json:"ip,omitempty"`
+	Loc     string   `json:"loc,omitempty"`
+	Op      string   `json:"op,omitempty"`
+	Operand string   `json:"operand,omitempty"`
+	Stack   []string `json:"stack,omitempty"`
+	Gas     *uint64  `json:"gas,omitempty"`
+	Native  uint64   `json:"native,omitempty"`
+	Key     string   `json:"key,omitempty"`
+	Value   string   `json:"value,omitempty"`
+	GasUsed *uint64  `json:"gasUsed,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (t *JSONTracer) CaptureStep(ip int, op OpCode, operand Word, stack []Word, gas uint64) {
+	stackView := make([]string, len(stack))
+	for i := range stack {
+		stackView[i] = stack[i].Hex()
+	}
+	ev := jsonTraceEvent{
+		Event:   "step",
+		IP:      &ip,
+		Op:      OpCodes[op],
+		Operand: operand.Hex(),
+		Stack:   stackView,
+		Gas:     &gas,
+	}
+	if loc, ok := t.sourceMap.Loc(ip); ok {
+		ev.Loc = loc.String()
+	}
+	t.encoder.Encode(ev)
+}
+
+func (t *JSONTracer) CaptureNative(ip int, id uint64) {
+	t.encoder.Encode(jsonTraceEvent{
+		Event:  "native",
+		IP:     &ip,
+		Native: id,
+	})
+}
+
+func (t *JSONTracer) CaptureStateRead(key common.Hash, value common.Hash) {
+	t.encoder.Encode(jsonTraceEvent{
+		Event: "sload",
+		Key:   key.Hex(),
+		Value: value.Hex(),
+	})
+}
+
+func (t *JSONTracer) CaptureStateWrite(key common.Hash, value common.Hash) {
+	t.encoder.Encode(jsonTraceEvent{
+		Event: "sstore",
+		Key:   key.Hex(),
+		Value: value.Hex(),
+	})
+}
+
+func (t *JSONTracer) CaptureEnd(gasUsed uint64, err error) {
+	ev := jsonTraceEvent{
+		Event:   "end",
+		GasUsed: &gasUsed,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.encoder.Encode(ev)
+}
@@ -0,0 +1,28 @@
+package eulvm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JSONTracer(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(counterProgram).WithTracer(NewJSONTracer(&buf)).Run(nil, 100_000)
+	assert.NoError(t, err)
+
+	var events []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var ev jsonTraceEvent
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev.Event)
+	}
+
+	assert.Equal(t, []string{
+		"step", "step", "step", "sload", "step", "step", "step", "sstore", "step", "end",
+	}, events)
+}
@@ -0,0 +1,380 @@
+package eulvm
+
+import (
+	"fmt"
+	"math"
+)
+
+// VerificationError describes the instruction which was rejected by Verify
+type VerificationError struct {
+	IP     int
+	OpCode OpCode
+	Reason string
+}
+
+func (err *VerificationError) Error() string {
+	return fmt.Sprintf("invalid program at ip %d (%s): %s", err.IP, OpCodes[err.OpCode], err.Reason)
+}
+
+// opcodes which are declared but not implemented by the vm yet
+var unimplementedOpCodes = map[OpCode]bool{
+	MSTORE8:  true,
+	MLOAD256: true,
+	PRINT:    true,
+	WRITESTR: true,
+}
+
+// unknownHeight marks instructions reachable only through calls of functions
+// whose stack effect can't be determined (for example they never return)
+const unknownHeight = math.MinInt
+
+// funcSummary is the result of the analysis of the code reachable from the function entry.
+// Heights inside of function are relative to the height of the stack right after CALL
+type funcSummary struct {
+	returns bool
+	delta   int // relative height of the stack at RET. Caller's height after the call changes by delta
+
+	callSites []callSite
+}
+
+type callSite struct {
+	ip     int
+	height int // height before the call
+	fn     int
+}
+
+type verifyItem struct {
+	ip     int
+	height int
+	fn     int
+}
+
+type verifier struct {
+	prog    Program
+	natives *NativeRegistry
+
+	visited []bool
+	heights []int
+	owners  []int // entry of the function the instruction belongs to
+
+	funcs    map[int]*funcSummary
+	worklist []verifyItem
+
+	targets map[int]bool // instructions which can be reached by jumps and calls
+}
+
+// Verify checks the program before execution. It rejects:
+//   - unknown and not implemented opcodes
+//   - jump and call targets outside of the program
+//   - unknown native functions
+//   - constant memory addresses outside of the memory
+//   - instructions reachable with different stack heights
+//
+// Code reachable only from CALLDATA is treated as separate functions starting at the lowest not visited instruction
+func Verify(prog Program) error {
+	return verifyProgram(prog, nil)
+}
+
+func verifyProgram(prog Program, natives *NativeRegistry) error {
+	v := &verifier{
+		prog:    prog,
+		natives: natives,
+		visited: make([]bool, len(prog.Instrutions)),
+		heights: make([]int, len(prog.Instrutions)),
+		owners:  make([]int, len(prog.Instrutions)),
+		funcs:   make(map[int]*funcSummary),
+		targets: make(map[int]bool),
+	}
+
+	if err := v.checkInstructions(); err != nil {
+		return err
+	}
+	return v.checkStackHeights()
+}
+
+func (v *verifier) fail(ip int, reason string, args ...interface{}) error {
+	return &VerificationError{
+		IP:     ip,
+		OpCode: v.prog.Instrutions[ip].OpCode,
+		Reason: fmt.Sprintf(reason, args...),
+	}
+}
+
+// checkInstructions validates every instruction separately
+func (v *verifier) checkInstructions() error {
+	size := uint64(len(v.prog.Instrutions))
+	for _, inst := range v.prog.Instrutions {
+		switch inst.OpCode {
+		case JUMPDEST, JUMPI, CALL:
+			if inst.Operand.IsUint64() && inst.Operand.Uint64() < size {
+				v.targets[int(inst.Operand.Uint64())] = true
+			}
+		}
+	}
+
+	for ip, inst := range v.prog.Instrutions {
+		if _, ok := OpCodes[inst.OpCode]; !ok || unimplementedOpCodes[inst.OpCode] {
+			return &VerificationError{
+				IP:     ip,
+				OpCode: inst.OpCode,
+				Reason: fmt.Sprintf("unknown opcode 0x%x", byte(inst.OpCode)),
+			}
+		}
+
+		switch inst.OpCode {
+		case JUMPDEST, JUMPI, CALL:
+			if !inst.Operand.IsUint64() || inst.Operand.Uint64() >= size {
+				return v.fail(ip, "target %s is outside of the program of size %d", inst.Operand.Dec(), size)
+			}
+		case SWAP:
+			if !inst.Operand.IsUint64() || inst.Operand.Uint64() >= maxStackSize {
+				return v.fail(ip, "swap depth %s is bigger than the stack", inst.Operand.Dec())
+			}
+		case LOG:
+			if !inst.Operand.IsUint64() || inst.Operand.Uint64() > MaxLogTopics {
+				return v.fail(ip, "log can't have %s topics, limit %d", inst.Operand.Dec(), MaxLogTopics)
+			}
+		case NATIVE:
+			if !inst.Operand.IsUint64() {
+				return v.fail(ip, "unknown native %s", inst.Operand.Dec())
+			}
+			if _, ok := v.natives.byID(inst.Operand.Uint64()); !ok && !isKnownNative(inst.Operand.Uint64()) {
+				return v.fail(ip, "unknown native %s", inst.Operand.Dec())
+			}
+		case MLOAD, DATALOAD:
+			addr, ok := v.constBefore(ip)
+			if !ok {
+				continue
+			}
+			if inst.OpCode == MLOAD {
+				if _, err := memoryOffset(&addr, 32); err != nil {
+					return v.fail(ip, "address %s is outside of the memory", addr.Dec())
+				}
+			} else if !addr.IsUint64() {
+				return v.fail(ip, "address %s is outside of the input", addr.Dec())
+			}
+		}
+	}
+	return nil
+}
+
+// constBefore returns operand of PUSH preceding the instruction if the instruction can be reached only after it
+func (v *verifier) constBefore(ip int) (Word, bool) {
+	if ip == 0 || v.prog.Instrutions[ip-1].OpCode != PUSH || v.targets[ip] {
+		return Word{}, false
+	}
+	return v.prog.Instrutions[ip-1].Operand, true
+}
+
+// checkStackHeights runs abstract interpretation of the program tracking only stack heights
+func (v *verifier) checkStackHeights() error {
+	if len(v.prog.Instrutions) == 0 {
+		return nil
+	}
+
+	v.addFunc(0)
+	for {
+		for len(v.worklist) > 0 {
+			item := v.worklist[len(v.worklist)-1]
+			v.worklist = v.worklist[:len(v.worklist)-1]
+			if err := v.visit(item); err != nil {
+				return err
+			}
+		}
+
+		// code after calls of functions which never return
+		var resolved bool
+		for _, fn := range v.funcs {
+			if fn.returns {
+				continue
+			}
+			for _, site := range fn.callSites {
+				if site.ip+1 < len(v.prog.Instrutions) && !v.visited[site.ip+1] {
+					v.push(site.ip+1, unknownHeight, site.fn)
+					resolved = true
+				}
+			}
+		}
+		if resolved {
+			continue
+		}
+
+		// code reachable only with CALLDATA
+		entry := -1
+		for ip, visited := range v.visited {
+			if !visited {
+				entry = ip
+				break
+			}
+		}
+		if entry == -1 {
+			return nil
+		}
+		v.addFunc(entry)
+	}
+}
+
+func (v *verifier) addFunc(entry int) *funcSummary {
+	fn := &funcSummary{}
+	v.funcs[entry] = fn
+	v.push(entry, 0, entry)
+	return fn
+}
+
+func (v *verifier) push(ip int, height int, fn int) {
+	v.worklist = append(v.worklist, verifyItem{ip, height, fn})
+}
+
+func (v *verifier) visit(item verifyItem) error {
+	ip, h, fn := item.ip, item.height, item.fn
+	if ip >= len(v.prog.Instrutions) {
+		return v.fail(ip-1, "execution continues after the end of the program")
+	}
+
+	if v.visited[ip] {
+		if v.owners[ip] != fn {
+			return v.fail(ip, "instruction is reachable from functions at %d and %d", v.owners[ip], fn)
+		}
+		if h == unknownHeight || h == v.heights[ip] {
+			return nil
+		}
+		if v.heights[ip] != unknownHeight {
+			return v.fail(ip, "inconsistent stack height %d != %d", v.heights[ip], h)
+		}
+	}
+	v.visited[ip] = true
+	v.heights[ip] = h
+	v.owners[ip] = fn
+
+	inst := v.prog.Instrutions[ip]
+	pops, pushes, err := v.stackEffect(ip)
+	if err != nil {
+		return err
+	}
+
+	next := unknownHeight
+	if h != unknownHeight {
+		if fn == 0 && h < pops {
+			return v.fail(ip, "stack underflow: height %d, required %d", h, pops)
+		}
+		next = h - pops + pushes
+		if fn == 0 && next > maxStackSize {
+			return v.fail(ip, "stack overflow: height %d, limit %d", next, maxStackSize)
+		}
+	}
+
+	target := int(inst.Operand.Uint64())
+	switch inst.OpCode {
+	case STOP, RETURN, REVERT, CALLDATA:
+		// CALLDATA jumps to the function defined by input, external functions are checked separately
+	case JUMPDEST:
+		v.push(target, next, fn)
+	case JUMPI:
+		v.push(target, next, fn)
+		v.push(ip+1, next, fn)
+	case RET:
+		return v.ret(ip, h, fn)
+	case CALL:
+		return v.call(ip, h, fn, target)
+	default:
+		v.push(ip+1, next, fn)
+	}
+	return nil
+}
+
+func (v *verifier) ret(ip int, h int, fn int) error {
+	summary := v.funcs[fn]
+	if summary.returns && summary.delta != unknownHeight {
+		if h != unknownHeight && h != summary.delta {
+			return v.fail(ip, "function at %d returns with inconsistent stack heights %d != %d", fn, summary.delta, h)
+		}
+		return nil
+	}
+	if summary.returns && h == unknownHeight {
+		return nil
+	}
+
+	summary.returns = true
+	summary.delta = h
+	for _, site := range summary.callSites {
+		v.push(site.ip+1, site.afterCall(h), site.fn)
+	}
+	return nil
+}
+
+func (v *verifier) call(ip int, h int, fn int, target int) error {
+	summary, ok := v.funcs[target]
+	if !ok {
+		if v.visited[target] {
+			return v.fail(ip, "call into the middle of the function at %d", v.owners[target])
+		}
+		summary = v.addFunc(target)
+	}
+
+	site := callSite{ip, h, fn}
+	summary.callSites = append(summary.callSites, site)
+	if summary.returns {
+		v.push(ip+1, site.afterCall(summary.delta), fn)
+	}
+	return nil
+}
+
+func (site callSite) afterCall(delta int) int {
+	if site.height == unknownHeight || delta == unknownHeight {
+		return unknownHeight
+	}
+	return site.height + delta
+}
+
+// stackEffect returns words the instruction pops and pushes
+func (v *verifier) stackEffect(ip int) (int, int, error) {
+	inst := v.prog.Instrutions[ip]
+	switch inst.OpCode {
+	case SWAP:
+		depth := int(inst.Operand.Uint64())
+		return depth + 1, depth + 1, nil
+	case LOG:
+		return 2 + int(inst.Operand.Uint64()), 0, nil
+	case NATIVE:
+		if native, ok := v.natives.byID(inst.Operand.Uint64()); ok {
+			pushes := 0
+			if native.Sig.Returns != NativeVoid {
+				pushes = 1
+			}
+			return len(native.Sig.Params), pushes, nil
+		}
+		if inst.Operand.Uint64() != NativeWriteF {
+			pops, pushes := nativeStackEffect(inst.Operand.Uint64())
+			return pops, pushes, nil
+		}
+		// writef stack effect depends on the format string. It must be pushed right before the call
+		format, ok := v.constString(ip)
+		if !ok {
+			return 0, 0, v.fail(ip, "writef format must be a constant string")
+		}
+		return 2 + writefArgsSize(format), 0, nil
+	}
+	effect := stackEffects[inst.OpCode]
+	return effect.pops, effect.pushes, nil
+}
+
+// constString returns the string from preallocated memory if its address and size were pushed right before the instruction
+func (v *verifier) constString(ip int) (string, bool) {
+	if ip < 2 {
+		return "", false
+	}
+	addrInst, sizeInst := v.prog.Instrutions[ip-2], v.prog.Instrutions[ip-1]
+	if addrInst.OpCode != PUSH || sizeInst.OpCode != PUSH || v.targets[ip] || v.targets[ip-1] {
+		return "", false
+	}
+	if !sizeInst.Operand.IsUint64() {
+		return "", false
+	}
+	size := sizeInst.Operand.Uint64()
+	if !addrInst.Operand.IsUint64() || addrInst.Operand.Uint64() > uint64(len(v.prog.PreallocMemory)) ||
+		uint64(len(v.prog.PreallocMemory))-addrInst.Operand.Uint64() < size {
+		return "", false
+	}
+	addr := addrInst.Operand.Uint64()
+	return string(v.prog.PreallocMemory[addr : addr+size]), true
+}
@@ -0,0 +1,81 @@
+package eulvm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Verify(t *testing.T) {
+	for _, prog := range []Program{loopProgram, counterProgram} {
+		assert.NoError(t, Verify(prog))
+	}
+
+	// 0: CALL 3, 1: DROP, 2: STOP, 3: PUSH 2, 4: SWAP 1, 5: RET
+	call := NewProgram([]Instruction{
+		{OpCode: CALL, Operand: *uint256.NewInt(3)},
+		{OpCode: DROP},
+		{OpCode: STOP},
+		{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+		{OpCode: SWAP, Operand: *uint256.NewInt(1)},
+		{OpCode: RET},
+	}, nil)
+	assert.NoError(t, Verify(call))
+}
+
+func Test_VerifyRejects(t *testing.T) {
+	cases := map[string]struct {
+		instructions []Instruction
+		ip           int
+	}{
+		"jump target": {[]Instruction{
+			{OpCode: JUMPDEST, Operand: *uint256.NewInt(10)},
+		}, 0},
+		"unknown opcode": {[]Instruction{
+			{OpCode: PUSH},
+			{OpCode: OpCode(0xff)},
+		}, 1},
+		"unknown native": {[]Instruction{
+			{OpCode: NATIVE, Operand: *uint256.NewInt(1000)},
+		}, 0},
+		"memory address": {[]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(MemoryCapacity)},
+			{OpCode: MLOAD},
+		}, 1},
+		"underflow": {[]Instruction{
+			{OpCode: PUSH},
+			{OpCode: ADD},
+		}, 1},
+		"merge heights": {[]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+			{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+			{OpCode: JUMPI, Operand: *uint256.NewInt(0)},
+			{OpCode: STOP},
+		}, 0},
+		"log topics": {[]Instruction{
+			{OpCode: PUSH},
+			{OpCode: PUSH},
+			{OpCode: LOG, Operand: *uint256.NewInt(MaxLogTopics + 1)},
+			{OpCode: STOP},
+		}, 2},
+		"log underflow": {[]Instruction{
+			{OpCode: PUSH},
+			{OpCode: PUSH},
+			{OpCode: LOG, Operand: *uint256.NewInt(1)},
+			{OpCode: STOP},
+		}, 2},
+		"falls through the end": {[]Instruction{
+			{OpCode: PUSH},
+		}, 0},
+	}
+
+	for name, c := range cases {
+		err := Verify(NewProgram(c.instructions, nil))
+		var verr *VerificationError
+		if assert.True(t, errors.As(err, &verr), name) {
+			assert.Equal(t, c.ip, verr.IP, name)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package eulvm
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"hash"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
 )
@@ -22,9 +26,12 @@ type keccakState interface {
 type EulVM struct {
 	program []Instruction //TODO make unsafe pointer to avoid program size check?
 
+	prealloc  []byte    // initial memory of the program. Memory gets reset to it before each run
+	sourceMap SourceMap // locations of instructions in the source, errors are reported with them
+
 	input []byte
 
-	state map[common.Hash]common.Hash // TODO later use actual stateDB as storage backend. map can be used for temporary map storage inside of smart contract
+	state *JournaledState // version storage. Changes get reverted if run fails
 
 	ip int
 
@@ -36,10 +43,26 @@ type EulVM struct {
 	hasherBuf    common.Hash // Keccak256 hasher result array shared aross opcodes
 	mapKeyBuffer [64]byte
 
-	debug bool
-}
+	gas      uint64 // gas left for the current run
+	gasLimit uint64
+	gasTable *GasSchedule
+
+	tracer  Tracer
+	session *Debugger // debug session which hasn't finished yet
+
+	natives *NativeRegistry // natives registered by host
+	ctx     Context         // environment of the run
 
-const ExecutionLimit = 1024
+	host    *Host          // set if the vm runs contract deployed to the host
+	address common.Address // address of the contract
+	depth   int            // depth of EXTCALL nesting, 0 for the call made by host
+
+	out    io.Writer // write and writef output goes here besides the result
+	output []byte    // output of the current run
+
+	returnData []byte // memory range returned by RETURN
+	logs       []Log  // logs emitted by the current run
+}
 
 func New(prog Program) *EulVM {
 	var m *Memory
@@ -49,93 +72,209 @@ func New(prog Program) *EulVM {
 		m = NewMemory()
 	}
 	return &EulVM{
-		program: prog.Instrutions,
-		memory:  m,
-		state:   make(map[common.Hash]common.Hash),
-		hasher:  sha3.NewLegacyKeccak256().(keccakState),
+		program:   prog.Instrutions,
+		prealloc:  prog.PreallocMemory,
+		sourceMap: prog.SourceMap,
+		memory:    m,
+		state:     NewJournaledState(NewMemoryStateDB()),
+		hasher:    sha3.NewLegacyKeccak256().(keccakState),
+		gasTable:  &DefaultGasSchedule,
+		out:       os.Stdout,
 	}
 }
 
-func (e *EulVM) WithDebug() *EulVM {
-	e.debug = true
+// NewVerified checks the program with Verify before creating the vm.
+// Programs from untrusted sources should be loaded with it.
+// Programs calling host natives should be checked with Verify method after WithNatives
+func NewVerified(prog Program) (*EulVM, error) {
+	if err := Verify(prog); err != nil {
+		return nil, err
+	}
+	return New(prog), nil
+}
+
+// Verify checks the program of the vm the same way as Verify does, calls of registered host natives are allowed
+func (e *EulVM) Verify() error {
+	return verifyProgram(Program{Instrutions: e.program, PreallocMemory: e.prealloc, SourceMap: e.sourceMap}, e.natives)
+}
+
+// WithOutput sets the writer for write and writef output, it's stdout by default.
+// Output is collected into the run result anyway, use io.Discard to only collect it
+func (e *EulVM) WithOutput(w io.Writer) *EulVM {
+	e.out = w
+	return e
+}
+
+// WithNatives sets registry of host natives which can be called by the program
+func (e *EulVM) WithNatives(natives *NativeRegistry) *EulVM {
+	e.natives = natives
+	return e
+}
+
+// WithStateDB sets the backend for version storage. State is kept in the backend between runs
+func (e *EulVM) WithStateDB(db StateDB) *EulVM {
+	e.state = NewJournaledState(db)
+	return e
+}
+
+// StateDB returns the version storage backend of the vm
+func (e *EulVM) StateDB() StateDB {
+	return e.state.db
+}
+
+// StateRoot returns the state root of version storage after the last run.
+// It returns false if StateDB backend doesn't implement StateRooter
+func (e *EulVM) StateRoot() (common.Hash, bool) {
+	rooter, ok := e.state.db.(StateRooter)
+	if !ok {
+		return common.Hash{}, false
+	}
+	return rooter.Root(), true
+}
+
+// WithGasSchedule replaces default opcode costs
+func (e *EulVM) WithGasSchedule(schedule *GasSchedule) *EulVM {
+	e.gasTable = schedule
+	return e
+}
+
+// WithTracer sets tracer which receives execution events
+func (e *EulVM) WithTracer(tracer Tracer) *EulVM {
+	e.tracer = tracer
 	return e
 }
 
-func (e *EulVM) Run(input []byte) error {
+// Result is the outcome of the run. It's filled up to the point of failure if the run fails
+type Result struct {
+	GasLeft uint64
+	GasUsed uint64
+
+	Output     []byte // everything written by write and writef
+	ReturnData []byte // data returned by RETURN opcode, nil if the program stopped without it
+	Logs       []Log  // logs emitted by the run. Logs of failed runs are discarded like the state changes
+}
+
+// Run executes the program with the given input until it stops or runs out of gas.
+// State changes are committed only if the run succeeds. It fails while the vm has open debug session
+func (e *EulVM) Run(input []byte, gasLimit uint64) (Result, error) {
+	if e.session != nil {
+		return Result{GasLeft: gasLimit}, errDebugSessionOpen
+	}
+	snapshot := e.state.Snapshot()
+	err := e.run(input, gasLimit)
+	if err != nil {
+		e.state.RevertToSnapshot(snapshot)
+	} else {
+		e.state.Commit()
+	}
+
+	if e.tracer != nil {
+		e.tracer.CaptureEnd(e.GasUsed(), err)
+	}
+	return e.result(), err
+}
+
+// run executes the program without touching state snapshots. Logs are dropped if it fails
+func (e *EulVM) run(input []byte, gasLimit uint64) error {
+	e.begin(input, gasLimit)
+	err := e.execute()
+	if err != nil {
+		e.logs = nil
+	}
+	return err
+}
+
+// begin prepares the vm for the run with the input
+func (e *EulVM) begin(input []byte, gasLimit uint64) {
+	e.Reset()
 	e.input = input
+	e.gas = gasLimit
+	e.gasLimit = gasLimit
+	e.output = nil
+	e.returnData = nil
+	e.logs = nil
+}
 
-	for i := 0; i < ExecutionLimit; i++ {
+func (e *EulVM) result() Result {
+	return Result{
+		GasLeft:    e.gas,
+		GasUsed:    e.GasUsed(),
+		Output:     e.output,
+		ReturnData: e.returnData,
+		Logs:       e.logs,
+	}
+}
+
+// write collects the output of the run and passes it to the output writer
+func (e *EulVM) write(p []byte) error {
+	e.output = append(e.output, p...)
+	if e.out == nil {
+		return nil
+	}
+	_, err := e.out.Write(p)
+	return err
+}
+
+// execute runs instructions until the program stops or fails
+func (e *EulVM) execute() error {
+	for {
 		err := executeNext(e)
+		if err == stopToken {
+			return nil
+		}
 		if err != nil {
-			if err == stopToken {
-				return nil
-			}
-			return err
+			return e.sourceError(err)
 		}
 	}
-	return errProgramLimitExceeded
+}
+
+// GasUsed returns the amount of gas consumed by the last run
+func (e *EulVM) GasUsed() uint64 {
+	return e.gasLimit - e.gas
 }
 
 var (
-	errIllegalCall          = errors.New("illegal program call")
-	errProgramLimitExceeded = errors.New("program limit cycle exceeded")
-	errInvalidOpCodeCalled  = errors.New("opcode doesn't exist")
-	errInvalidMemoryAccess  = errors.New("program accessed memory beyond memory capacity")
-	errUnknownNative        = errors.New("native function doesn't exists")
+	errIllegalCall         = errors.New("illegal program call")
+	errInvalidOpCodeCalled = errors.New("opcode doesn't exist")
+	errInvalidMemoryAccess = errors.New("program accessed memory beyond memory capacity")
+	errInvalidInputAccess  = errors.New("program accessed input beyond input size")
+	errUnknownNative       = errors.New("native function doesn't exists")
+	errInvalidLogTopics    = errors.New("log has too many topics")
 )
 
 var stopToken = errors.New("program stopped")
 
-var debugCounter int
-var breakPoint int
+// RevertError is returned when the program aborts itself with REVERT. State changes of the run are discarded
+type RevertError struct {
+	IP     int
+	Reason string
+}
+
+func (err *RevertError) Error() string {
+	if err.Reason == "" {
+		return fmt.Sprintf("execution reverted at ip %d", err.IP)
+	}
+	return fmt.Sprintf("execution reverted at ip %d: %s", err.IP, err.Reason)
+}
 
 func executeNext(e *EulVM) error {
-	if e.ip >= len(e.program) {
+	if e.ip < 0 || e.ip >= len(e.program) {
 		return errIllegalCall
 	}
 
 	inst := e.program[e.ip]
-	if e.debug {
-		debugCounter++
-		if debugCounter < breakPoint {
-			goto exec
-		}
-		var command string
-		var operand int
-		fmt.Scanf("%s %d", &command, &operand)
-		command = strings.TrimSpace(command)
-		switch command {
-		case "help":
-			fmt.Println(
-				` debug mode for evm commands:
-			  stack - dump current stack state
-			  memory - dump current memory state
-			  next_op or ''- show next command for execution
-			  break - go to break point of debuger
-			`)
-			debugCounter--
-			return nil
-		case "stack":
-			e.Dump()
-			debugCounter--
-			return nil
-		case "memory":
-			e.memory.Dump()
-			debugCounter--
-			return nil
-		case "", "next_op":
-		case "break":
-			debugCounter--
-			breakPoint = operand
-		default:
-			fmt.Println("use help to get commands info")
-			return nil
-		}
-		fmt.Println("debug point", debugCounter, "ip:", e.ip, "-->call:",
-			OpCodes[inst.OpCode],
-			"operand:", inst.Operand.Uint64())
+	if e.tracer != nil {
+		e.tracer.CaptureStep(e.ip, inst.OpCode, inst.Operand, e.stack[1:e.stackSize+1], e.gas)
 	}
-exec:
+
+	if err := e.checkStack(inst); err != nil {
+		return err
+	}
+
+	if !e.useGas(inst.OpCode) {
+		return e.outOfGas()
+	}
+
 	switch inst.OpCode {
 	case PUSH:
 		e.stackSize++
@@ -176,15 +315,12 @@ exec:
 		e.ip++
 		return nil
 	case JUMPDEST:
-		// TODO validate pointer for jump instructions (or maybe it's already done?)
-		e.ip = int(inst.Operand.Uint64())
-		return nil
+		return e.jump(inst.Operand)
 	case JUMPI:
 		cond := e.stack[e.stackSize]
 		e.stackSize--
 		if !cond.IsZero() {
-			e.ip = int(inst.Operand.Uint64())
-			return nil
+			return e.jump(inst.Operand)
 		}
 		e.ip++
 		return nil
@@ -198,19 +334,28 @@ exec:
 		return nil
 	// TODO in a future case MSTORE8:
 	case NATIVE:
+		if e.tracer != nil {
+			e.tracer.CaptureNative(e.ip, inst.Operand.Uint64())
+		}
+		if err := e.execNative(inst.Operand.Uint64()); err != nil {
+			return err
+		}
 		e.ip++
-		return e.execNative(inst.Operand.Uint64())
+		return nil
 	case MSTORE256:
-		offset := e.stack[e.stackSize-1].Uint64()
+		offset, err := memoryOffset(&e.stack[e.stackSize-1], 32)
+		if err != nil {
+			return err
+		}
 		val := e.stack[e.stackSize]
 		e.memory.Set32(offset, val)
 		e.stackSize -= 2
 		e.ip++
 		return nil
 	case MLOAD:
-		addr := e.stack[e.stackSize].Uint64()
-		if addr > MemoryCapacity {
-			return errInvalidMemoryAccess
+		addr, err := memoryOffset(&e.stack[e.stackSize], 32)
+		if err != nil {
+			return err
 		}
 
 		e.stack[e.stackSize].SetBytes(e.memory.store[addr : addr+32])
@@ -220,12 +365,12 @@ exec:
 		val := e.stack[e.stackSize]
 		key := e.stack[e.stackSize-1]
 		e.stackSize -= 2
-		e.state[key.Bytes32()] = val.Bytes32()
+		e.sstore(key.Bytes32(), val.Bytes32())
 		e.ip++
 		return nil
 	case VSLOAD:
 		key := e.stack[e.stackSize].Bytes32()
-		e.stack[e.stackSize].SetBytes(e.state[key].Bytes())
+		e.stack[e.stackSize].SetBytes(e.sload(key).Bytes())
 		e.ip++
 		return nil
 	case MAPVSSTORE:
@@ -238,11 +383,28 @@ exec:
 		e.hasher.Write(e.mapKeyBuffer[:])
 		e.hasher.Read(e.hasherBuf[:])
 
-		e.state[e.hasherBuf] = val.Bytes32()
+		e.sstore(e.hasherBuf, val.Bytes32())
 
 		e.stackSize -= 2
 		e.ip++
 		return nil
+	case CALLER, ORIGIN, NUMBER, TIMESTAMP, CHAINID:
+		e.stackSize++
+		e.stack[e.stackSize] = e.contextWord(inst.OpCode)
+		e.ip++
+		return nil
+	case EXTCALL:
+		if err := e.execExtCall(); err != nil {
+			return err
+		}
+		e.ip++
+		return nil
+	case LOG:
+		if err := e.execLog(inst.Operand); err != nil {
+			return err
+		}
+		e.ip++
+		return nil
 	case MAPVSSLOAD:
 		key := e.stack[e.stackSize].Bytes()
 		copy(e.mapKeyBuffer[:32], key)
@@ -252,7 +414,7 @@ exec:
 		e.hasher.Write(e.mapKeyBuffer[:])
 		e.hasher.Read(e.hasherBuf[:])
 
-		e.stack[e.stackSize].SetBytes(e.state[e.hasherBuf].Bytes())
+		e.stack[e.stackSize].SetBytes(e.sload(e.hasherBuf).Bytes())
 		e.ip++
 		return nil
 	case LT:
@@ -277,6 +439,28 @@ exec:
 		}
 		e.ip++
 		return nil
+	case SLT:
+		x := e.stack[e.stackSize-1]
+		y := e.stack[e.stackSize]
+		e.stackSize--
+		if x.Slt(&y) {
+			e.stack[e.stackSize].SetOne()
+		} else {
+			e.stack[e.stackSize].Clear()
+		}
+		e.ip++
+		return nil
+	case SGT:
+		x := e.stack[e.stackSize-1]
+		y := e.stack[e.stackSize]
+		e.stackSize--
+		if x.Sgt(&y) {
+			e.stack[e.stackSize].SetOne()
+		} else {
+			e.stack[e.stackSize].Clear()
+		}
+		e.ip++
+		return nil
 	case SUB:
 		x := e.stack[e.stackSize]
 		y := e.stack[e.stackSize-1]
@@ -284,6 +468,46 @@ exec:
 		e.stack[e.stackSize] = *y.Sub(&y, &x)
 		e.ip++
 		return nil
+	case MUL:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.Mul(&y, &x)
+		e.ip++
+		return nil
+	case DIV:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.Div(&y, &x)
+		e.ip++
+		return nil
+	case MOD:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.Mod(&y, &x)
+		e.ip++
+		return nil
+	case SDIV:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.SDiv(&y, &x)
+		e.ip++
+		return nil
+	case SMOD:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.SMod(&y, &x)
+		e.ip++
+		return nil
+	case SIGNEXTEND:
+		x := &e.stack[e.stackSize]
+		x.ExtendSign(x, &inst.Operand)
+		e.ip++
+		return nil
 	case AND:
 		x := e.stack[e.stackSize]
 		y := e.stack[e.stackSize-1]
@@ -298,6 +522,36 @@ exec:
 		e.stack[e.stackSize] = *y.Or(&y, &x)
 		e.ip++
 		return nil
+	case XOR:
+		x := e.stack[e.stackSize]
+		y := e.stack[e.stackSize-1]
+		e.stackSize--
+		e.stack[e.stackSize] = *y.Xor(&y, &x)
+		e.ip++
+		return nil
+	case BNOT:
+		x := &e.stack[e.stackSize]
+		x.Not(x)
+		e.ip++
+		return nil
+	case SHL, SHR, SAR:
+		x := e.stack[e.stackSize]
+		y := &e.stack[e.stackSize-1]
+		e.stackSize--
+		shift := uint(256)
+		if x.LtUint64(256) {
+			shift = uint(x.Uint64())
+		}
+		switch inst.OpCode {
+		case SHL:
+			y.Lsh(y, shift)
+		case SHR:
+			y.Rsh(y, shift)
+		case SAR:
+			y.SRsh(y, shift)
+		}
+		e.ip++
+		return nil
 	case NOP:
 		e.ip++
 		return nil
@@ -316,14 +570,16 @@ exec:
 	case CALL:
 		e.stackSize += 1
 		e.stack[e.stackSize] = *uint256.NewInt(uint64(e.ip + 1)) //set return address of the call
-		e.ip = int(inst.Operand.Uint64())                        //ip jumps to function
-		return nil
+		return e.jump(inst.Operand)                              //ip jumps to function
 	case RET:
 		e.ip = int(e.stack[e.stackSize].Uint64())
 		e.stackSize--
 		return nil
 	case CALLDATA:
 		//TODO later implement load of call parameters
+		if len(e.input) < 32 {
+			return errInvalidInputAccess
+		}
 		var addr uint256.Int
 		addr.SetBytes(e.input[:32])
 		e.stackSize++
@@ -332,14 +588,15 @@ exec:
 		e.ip = int(addr.Uint64()) // set instruction pointer to entry function
 		return nil
 	case DATALOAD:
-		//TODO boundary cheks
-		from := e.stack[e.stackSize].Uint64()
-		val := e.input[from : from+WordLength.Uint64()]
+		from := &e.stack[e.stackSize]
+		if !from.IsUint64() || from.Uint64() > uint64(len(e.input)) || uint64(len(e.input))-from.Uint64() < WordLength.Uint64() {
+			return errInvalidInputAccess
+		}
+		val := e.input[from.Uint64() : from.Uint64()+WordLength.Uint64()]
 		e.stack[e.stackSize].SetBytes(val)
 		e.ip++
 		return nil
 	case SWAP:
-		//TODO add stack overflow check
 		a := e.stackSize
 		b := e.stackSize - int(inst.Operand.Uint64())
 		e.stack[a], e.stack[b] = e.stack[b], e.stack[a]
@@ -347,15 +604,33 @@ exec:
 		return nil
 	case STOP:
 		return stopToken
+	case RETURN:
+		data, err := e.popMemoryRange()
+		if err != nil {
+			return err
+		}
+		e.returnData = data
+		return stopToken
+	case REVERT:
+		reason, err := e.popMemoryRange()
+		if err != nil {
+			return err
+		}
+		return &RevertError{
+			IP:     e.ip,
+			Reason: string(reason),
+		}
 	}
 
 	return errInvalidOpCodeCalled
 
 }
 
+// Reset prepares the vm for the next run. State isn't affected
 func (e *EulVM) Reset() {
 	e.ip = 0
 	e.stackSize = 0
+	e.memory.reset(e.prealloc)
 }
 
 func (e *EulVM) Dump() {
@@ -371,83 +646,272 @@ func (e *EulVM) Dump() {
 const (
 	NativeWrite uint64 = iota + 1
 	NativeWriteF
+
+	// hash natives push bytes32 hash. Word versions hash 32 bytes of the big endian word,
+	// Str versions hash the string bytes from memory
+	NativeKeccak256
+	NativeSha256
+	NativeKeccak256Str
+	NativeSha256Str
+
+	// ecrecover pops s, r, v and hash (s is on top) and pushes address of the signer.
+	// v is 27 or 28 (0 and 1 are accepted too). Zero address is pushed if signature is invalid
+	NativeEcrecover
 )
 
-func (e *EulVM) popInt() int {
+// popMemoryRange pops size and address of memory range (size is on top) and returns a copy of it
+func (e *EulVM) popMemoryRange() ([]byte, error) {
+	size := e.stack[e.stackSize]
+	if !size.IsUint64() {
+		return nil, errInvalidMemoryAccess
+	}
+	addr, err := memoryOffset(&e.stack[e.stackSize-1], size.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	e.stackSize -= 2
+	data := make([]byte, size.Uint64())
+	copy(data, e.memory.store[addr:])
+	return data, nil
+}
+
+// jump moves ip to the target. Targets outside of the program fail on the next instruction
+func (e *EulVM) jump(target Word) error {
+	if !target.IsUint64() {
+		return errIllegalCall
+	}
+	e.ip = int(target.Uint64())
+	return nil
+}
+
+// pop helpers are used by natives. Natives are always called by NATIVE opcode
+// popInt pops the word as two's complement int64
+func (e *EulVM) popInt() (int64, error) {
+	if err := e.ensureStack(NATIVE, 1); err != nil {
+		return 0, err
+	}
 	ret := e.stack[e.stackSize].Uint64()
 	e.stackSize--
-	return int(ret)
+	return int64(ret), nil
 }
 
-func (e *EulVM) popHash() common.Hash {
+func (e *EulVM) popHash() (common.Hash, error) {
+	if err := e.ensureStack(NATIVE, 1); err != nil {
+		return common.Hash{}, err
+	}
 	ret := e.stack[e.stackSize]
 	e.stackSize--
-	return common.BytesToHash(ret.Bytes())
+	return common.BytesToHash(ret.Bytes()), nil
+}
+
+func (e *EulVM) popStr() (string, error) {
+	b, err := e.popBytes()
+	return string(b), err
 }
 
-func (e *EulVM) popStr() string {
+// popBytes pops address and size of the memory slice. The slice isn't copied
+func (e *EulVM) popBytes() ([]byte, error) {
+	if err := e.ensureStack(NATIVE, 2); err != nil {
+		return nil, err
+	}
 	size := e.stack[e.stackSize]
-	addr := e.stack[e.stackSize-1]
+	if !size.IsUint64() {
+		return nil, errInvalidMemoryAccess
+	}
+	addr, err := memoryOffset(&e.stack[e.stackSize-1], size.Uint64())
+	if err != nil {
+		return nil, err
+	}
 	e.stackSize -= 2
-	return string(e.memory.store[addr.Uint64() : addr.Uint64()+size.Uint64()])
+	return e.memory.store[addr : addr+size.Uint64()], nil
 }
 
-func (e *EulVM) popAddr() common.Address {
+func (e *EulVM) popAddr() (common.Address, error) {
+	if err := e.ensureStack(NATIVE, 1); err != nil {
+		return common.Address{}, err
+	}
 	ret := e.stack[e.stackSize]
 	e.stackSize--
-	return common.BytesToAddress(ret.Bytes())
+	return common.BytesToAddress(ret.Bytes()), nil
+}
+
+// sload reads the value from version storage
+func (e *EulVM) sload(key common.Hash) common.Hash {
+	val := e.state.Get(key)
+	if e.tracer != nil {
+		e.tracer.CaptureStateRead(key, val)
+	}
+	return val
+}
+
+// sstore writes the value into version storage
+func (e *EulVM) sstore(key common.Hash, val common.Hash) {
+	e.state.Set(key, val)
+	if e.tracer != nil {
+		e.tracer.CaptureStateWrite(key, val)
+	}
 }
 
 func (e *EulVM) execNative(id uint64) error {
 	switch id {
 	case NativeWrite:
-		size := e.stack[e.stackSize]
-		addr := e.stack[e.stackSize-1]
-		e.stackSize -= 2
-		fmt.Print(string(e.memory.store[addr.Uint64() : addr.Uint64()+size.Uint64()]))
-		return nil
+		str, err := e.popStr()
+		if err != nil {
+			return err
+		}
+		return e.write([]byte(str))
 	case NativeWriteF:
-		// TODO add stack overflow check
 		var args []interface{}
 
-		frmtStr := e.popStr()
-		clone := strings.Clone(frmtStr)
-		for clone != chopFrom(clone, isPercent) {
-			clone = chopFrom(clone, isPercent)
-			if strings.HasPrefix(clone, "%d") {
-				args = append(args, e.popInt())
-				clone = strings.TrimPrefix(clone, "%d")
-			} else if strings.HasPrefix(clone, "%s") {
-				args = append(args, e.popStr())
-				clone = strings.TrimPrefix(clone, "%s")
-				// NOTE add here future formattings
-			} else if strings.HasPrefix(clone, "%v") {
-				args = append(args, e.popHash())
-				clone = strings.TrimPrefix(clone, "%v")
-			} else if strings.HasPrefix(clone, "%x") {
-				args = append(args, e.popAddr())
-				clone = strings.TrimPrefix(clone, "%x")
-			} else {
-				clone = strings.TrimPrefix(clone, "%")
+		frmtStr, err := e.popStr()
+		if err != nil {
+			return err
+		}
+		for _, verb := range writefVerbs(frmtStr) {
+			var arg interface{}
+			switch verb {
+			case "%d":
+				arg, err = e.popInt()
+			case "%s":
+				arg, err = e.popStr()
+			case "%v":
+				arg, err = e.popHash()
+			case "%x":
+				arg, err = e.popAddr()
+			}
+			if err != nil {
+				return err
 			}
+			args = append(args, arg)
 		}
 
-		fmt.Printf(frmtStr, args...)
+		return e.write(fmt.Appendf(nil, frmtStr, args...))
+	case NativeKeccak256, NativeSha256:
+		if err := e.ensureStack(NATIVE, 1); err != nil {
+			return err
+		}
+		word := e.stack[e.stackSize].Bytes32()
+		e.stack[e.stackSize].SetBytes32(e.hash(id, word[:]))
+		return nil
+	case NativeKeccak256Str, NativeSha256Str:
+		data, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		e.stackSize++
+		e.stack[e.stackSize].SetBytes32(e.hash(id, data))
+		return nil
+	case NativeEcrecover:
+		if err := e.ensureStack(NATIVE, 4); err != nil {
+			return err
+		}
+		s := e.stack[e.stackSize]
+		r := e.stack[e.stackSize-1]
+		v := e.stack[e.stackSize-2]
+		e.stackSize -= 3
+		hash := e.stack[e.stackSize].Bytes32()
+
+		signer := ecrecover(hash, &v, &r, &s)
+		e.stack[e.stackSize].SetBytes20(signer[:])
 		return nil
 	}
 
+	if id&hostNativeFlag != 0 {
+		return e.execHostNative(id)
+	}
 	return errUnknownNative
 }
 
-func isPercent(r rune) bool {
-	return r != '%'
+// ecrecover returns zero address if the signature is invalid
+func ecrecover(hash [32]byte, v, r, s *Word) common.Address {
+	if v.GtUint64(28) {
+		return common.Address{}
+	}
+	recID := byte(v.Uint64())
+	if recID >= 27 {
+		recID -= 27
+	}
+	if !crypto.ValidateSignatureValues(recID, r.ToBig(), s.ToBig(), false) {
+		return common.Address{}
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	r.WriteToSlice(sig[:32])
+	s.WriteToSlice(sig[32:64])
+	sig[crypto.RecoveryIDOffset] = recID
+
+	pub, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return common.Address{}
+	}
+	return crypto.PubkeyToAddress(*pub)
+}
+
+// hash calculates keccak256 or sha256 of the data depending on hash native id
+func (e *EulVM) hash(id uint64, data []byte) []byte {
+	if id == NativeSha256 || id == NativeSha256Str {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	e.hasher.Reset()
+	e.hasher.Write(data)
+	e.hasher.Read(e.hasherBuf[:])
+	return e.hasherBuf[:]
+}
+
+func isKnownNative(id uint64) bool {
+	return id >= NativeWrite && id <= NativeEcrecover
 }
 
-func chopFrom(s string, until func(r rune) bool) string {
-	for i, r := range s {
-		if !until(r) {
-			return s[i:]
+// nativeStackEffect returns words popped and pushed by the native with fixed signature
+func nativeStackEffect(id uint64) (int, int) {
+	switch id {
+	case NativeWrite:
+		return 2, 0
+	case NativeKeccak256, NativeSha256:
+		return 1, 1
+	case NativeKeccak256Str, NativeSha256Str:
+		return 2, 1
+	case NativeEcrecover:
+		return 4, 1
+	}
+	return 0, 0
+}
+
+// writef formatting verbs. NOTE add here future formattings
+var writefArgVerbs = []string{"%d", "%s", "%v", "%x"}
+
+// writefVerbs returns formatting verbs of the writef format string in order of their appearance
+func writefVerbs(format string) []string {
+	var verbs []string
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if strings.HasPrefix(format[i:], "%%") {
+			i++
+			continue
+		}
+		for _, v := range writefArgVerbs {
+			if strings.HasPrefix(format[i:], v) {
+				verbs = append(verbs, v)
+				i += len(v) - 1
+				break
+			}
+		}
+	}
+	return verbs
+}
+
+// writefArgsSize returns amount of words writef pops for the arguments of the format string
+func writefArgsSize(format string) int {
+	size := 0
+	for _, verb := range writefVerbs(format) {
+		if verb == "%s" {
+			size += 2 // string is represented by address and size
+		} else {
+			size++
 		}
 	}
-	return s
+	return size
 }
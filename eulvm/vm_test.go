@@ -1,12 +1,522 @@
 package eulvm
 
 import (
+	"bytes"
+	"errors"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_nativeWrite(t *testing.T) {
 
 }
 
+// loopProgram never stops, it can only be terminated by running out of gas
+var loopProgram = NewProgram([]Instruction{
+	{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+	{OpCode: DROP},
+	{OpCode: JUMPDEST, Operand: *uint256.NewInt(0)},
+}, nil)
+
+func Test_RunGas(t *testing.T) {
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+		{OpCode: ADD},
+		{OpCode: STOP},
+	}, nil)
+
+	res, err := New(prog).Run(nil, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100-3-3-3), res.GasLeft)
+	assert.Equal(t, uint64(3+3+3), res.GasUsed)
+}
+
+func Test_RunOutOfGas(t *testing.T) {
+	e := New(loopProgram)
+	res, err := e.Run(nil, 1000)
+
+	var oog *OutOfGasError
+	assert.True(t, errors.As(err, &oog))
+	assert.Equal(t, uint64(0), res.GasLeft)
+	assert.Equal(t, uint64(1000), oog.GasLimit)
+	assert.LessOrEqual(t, oog.GasUsed, uint64(1000))
+}
+
+func Test_RunCustomGasSchedule(t *testing.T) {
+	schedule := DefaultGasSchedule
+	schedule[PUSH] = 10
+
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: STOP},
+	}, nil)
+
+	e := New(prog).WithGasSchedule(&schedule)
+	res, err := e.Run(nil, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(90), res.GasLeft)
+	assert.Equal(t, uint64(10), e.GasUsed())
+}
+
+// counterProgram increments the value stored under key 1 in version storage
+var counterProgram = NewProgram([]Instruction{
+	{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+	{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+	{OpCode: VSLOAD},
+	{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+	{OpCode: ADD},
+	{OpCode: VSSTORE},
+	{OpCode: STOP},
+}, nil)
+
+func Test_StateSurvivesRuns(t *testing.T) {
+	db := NewMemoryStateDB()
+	e := New(counterProgram).WithStateDB(db)
+
+	for i := 0; i < 3; i++ {
+		_, err := e.Run(nil, 100_000)
+		assert.NoError(t, err)
+	}
+
+	key := uint256.NewInt(1).Bytes32()
+	val := db.Get(key)
+	assert.Equal(t, uint256.NewInt(3).Bytes32(), [32]byte(val))
+	assert.Equal(t, 1, db.Len())
+}
+
+func Test_FailedRunRevertsState(t *testing.T) {
+	db := NewMemoryStateDB()
+	e := New(counterProgram).WithStateDB(db)
+	_, err := e.Run(nil, 100_000)
+	assert.NoError(t, err)
+
+	// counter program without STOP in the end fails on the illegal call after the write
+	failing := NewProgram(counterProgram.Instrutions[:len(counterProgram.Instrutions)-1], nil)
+	_, err = New(failing).WithStateDB(db).Run(nil, 100_000)
+	assert.ErrorIs(t, err, errIllegalCall)
+
+	key := uint256.NewInt(1).Bytes32()
+	assert.Equal(t, uint256.NewInt(1).Bytes32(), [32]byte(db.Get(key)))
+}
+
+func Test_RevertDiscardsState(t *testing.T) {
+	db := NewMemoryStateDB()
+	_, err := New(counterProgram).WithStateDB(db).Run(nil, 100_000)
+	assert.NoError(t, err)
+
+	// counter program reverting after the write
+	instructions := append([]Instruction{}, counterProgram.Instrutions[:len(counterProgram.Instrutions)-1]...)
+	instructions = append(instructions,
+		Instruction{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		Instruction{OpCode: PUSH, Operand: *uint256.NewInt(6)},
+		Instruction{OpCode: REVERT},
+	)
+	e, err := NewVerified(NewProgram(instructions, []byte("denied")))
+	assert.NoError(t, err)
+	_, err = e.WithStateDB(db).Run(nil, 100_000)
+
+	var rerr *RevertError
+	assert.True(t, errors.As(err, &rerr))
+	assert.Equal(t, "denied", rerr.Reason)
+	assert.Equal(t, len(instructions)-1, rerr.IP)
+	assert.EqualError(t, err, "execution reverted at ip 8: denied")
+
+	key := uint256.NewInt(1).Bytes32()
+	assert.Equal(t, uint256.NewInt(1).Bytes32(), [32]byte(db.Get(key)))
+}
+
+func Test_RunSourceError(t *testing.T) {
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(6)},
+		{OpCode: REVERT},
+	}, []byte("denied"))
+	prog.SourceMap = SourceMap{{}, {}, {File: "deny.eul", Row: 3, Col: 4, Func: "deny"}}
+
+	_, err := New(prog).Run(nil, 100_000)
+	var serr *SourceError
+	assert.True(t, errors.As(err, &serr))
+	assert.Equal(t, "deny", serr.Loc.Func)
+	assert.EqualError(t, err, "deny.eul:3:4: execution reverted at ip 2: denied")
+
+	var rerr *RevertError
+	assert.True(t, errors.As(err, &rerr))
+
+	// errors of instructions without location stay as they are
+	prog.SourceMap[2] = SourceLoc{}
+	_, err = New(prog).Run(nil, 100_000)
+	assert.EqualError(t, err, "execution reverted at ip 2: denied")
+}
+
+func Test_RunLogs(t *testing.T) {
+	// logs "data" with topics 1 and 2, then fails if input is empty
+	instructions := []Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(4)},
+		{OpCode: LOG, Operand: *uint256.NewInt(2)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: DATALOAD},
+		{OpCode: DROP},
+		{OpCode: STOP},
+	}
+	e, err := NewVerified(NewProgram(instructions, []byte("data")))
+	assert.NoError(t, err)
+
+	res, err := e.Run(make([]byte, 32), 10_000)
+	assert.NoError(t, err)
+	assert.Equal(t, []Log{{
+		Topics: []common.Hash{{31: 1}, {31: 2}},
+		Data:   []byte("data"),
+	}}, res.Logs)
+
+	res, err = e.Run(nil, 10_000)
+	assert.ErrorIs(t, err, errInvalidInputAccess)
+	assert.Nil(t, res.Logs)
+}
+
+func Test_RunLogGas(t *testing.T) {
+	logProgram := func(size uint64) Program {
+		return NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+			{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+			{OpCode: PUSH, Operand: *uint256.NewInt(size)},
+			{OpCode: LOG, Operand: *uint256.NewInt(1)},
+			{OpCode: STOP},
+		}, make([]byte, 32))
+	}
+
+	e := New(logProgram(4))
+	_, err := e.Run(nil, 100_000)
+	assert.NoError(t, err)
+	small := e.GasUsed()
+	assert.Equal(t, 3*3+375+LogTopicGas+4*LogDataGas, small)
+
+	e = New(logProgram(1024))
+	_, err = e.Run(nil, 100_000)
+	assert.NoError(t, err)
+	assert.Equal(t, small+1020*LogDataGas, e.GasUsed())
+
+	// the whole memory doesn't fit into the limit
+	_, err = New(logProgram(MemoryCapacity)).Run(nil, 100_000)
+	var gasErr *OutOfGasError
+	assert.True(t, errors.As(err, &gasErr))
+	assert.Equal(t, LOG, gasErr.OpCode)
+}
+
+func Test_RunContext(t *testing.T) {
+	prog := NewProgram([]Instruction{
+		{OpCode: CALLER},
+		{OpCode: ORIGIN},
+		{OpCode: NUMBER},
+		{OpCode: TIMESTAMP},
+		{OpCode: CHAINID},
+		{OpCode: STOP},
+	}, nil)
+	ctx := Context{
+		Caller:      common.HexToAddress("0x01"),
+		Origin:      common.HexToAddress("0x02"),
+		BlockNumber: 3,
+		Timestamp:   4,
+		ChainID:     5,
+	}
+	e, err := NewVerified(prog)
+	assert.NoError(t, err)
+	_, err = e.WithContext(ctx).Run(nil, 10_000)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, e.stackSize)
+	for i := 1; i <= 5; i++ {
+		assert.Equal(t, uint64(i), e.stack[i].Uint64())
+	}
+	assert.Equal(t, ctx, e.Context())
+}
+
+func Test_StackErrors(t *testing.T) {
+	underflow := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: ADD},
+	}, nil)
+	_, err := New(underflow).Run(nil, 100_000)
+	var uerr *StackUnderflowError
+	assert.True(t, errors.As(err, &uerr))
+	assert.Equal(t, 1, uerr.IP)
+	assert.Equal(t, ADD, uerr.OpCode)
+
+	overflow := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: JUMPDEST, Operand: *uint256.NewInt(0)},
+	}, nil)
+	_, err = New(overflow).Run(nil, 100_000)
+	var oerr *StackOverflowError
+	assert.True(t, errors.As(err, &oerr))
+	assert.Equal(t, PUSH, oerr.OpCode)
+	assert.Equal(t, StackCapacity-1, oerr.StackSize)
+
+	swap := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+		{OpCode: SWAP, Operand: *uint256.NewInt(1)},
+	}, nil)
+	_, err = New(swap).Run(nil, 100_000)
+	var serr *InvalidSwapDepthError
+	assert.True(t, errors.As(err, &serr))
+	assert.Equal(t, 1, serr.IP)
+
+	native := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(NativeWrite)},
+	}, nil)
+	_, err = New(native).Run(nil, 100_000)
+	assert.True(t, errors.As(err, &uerr))
+	assert.Equal(t, NATIVE, uerr.OpCode)
+	assert.Equal(t, 1, uerr.IP)
+}
+
+func Test_InvalidMemoryAccess(t *testing.T) {
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(MemoryCapacity - 16)},
+		{OpCode: MLOAD},
+	}, nil)
+	_, err := New(prog).Run(nil, 100_000)
+	assert.ErrorIs(t, err, errInvalidMemoryAccess)
+
+	jump := NewProgram([]Instruction{
+		{OpCode: JUMPDEST, Operand: *new(uint256.Int).SetAllOne()},
+	}, nil)
+	_, err = New(jump).Run(nil, 100_000)
+	assert.ErrorIs(t, err, errIllegalCall)
+
+	// targets don't wrap to the low 64 bits
+	wrapped := new(uint256.Int).Lsh(uint256.NewInt(1), 64)
+	for _, op := range []OpCode{JUMPDEST, JUMPI, CALL} {
+		jump := NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(1)},
+			{OpCode: op, Operand: *wrapped},
+		}, nil)
+		_, err = New(jump).Run(nil, 100_000)
+		assert.ErrorIs(t, err, errIllegalCall, OpCodes[op])
+	}
+}
+
+func Test_Arithmetic(t *testing.T) {
+	tests := []struct {
+		op   OpCode
+		y, x uint64
+		want uint64
+	}{
+		{MUL, 6, 7, 42},
+		{DIV, 42, 5, 8},
+		{MOD, 42, 5, 2},
+		{DIV, 42, 0, 0},
+		{MOD, 42, 0, 0},
+		{XOR, 0b1100, 0b1010, 0b0110},
+		{SHL, 1, 4, 16},
+		{SHR, 16, 4, 1},
+		{SHL, 1, 256, 0},
+		{SHR, 16, 1000, 0},
+	}
+
+	for _, tt := range tests {
+		e := New(NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(tt.y)},
+			{OpCode: PUSH, Operand: *uint256.NewInt(tt.x)},
+			{OpCode: tt.op},
+			{OpCode: STOP},
+		}, nil))
+
+		_, err := e.Run(nil, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, e.stackSize)
+		assert.Equal(t, tt.want, e.stack[1].Uint64(), "%s %d %d", OpCodes[tt.op], tt.y, tt.x)
+	}
+}
+
+func Test_SignedArithmetic(t *testing.T) {
+	word := func(v int64) Word {
+		w := uint256.NewInt(uint64(v))
+		return *w.ExtendSign(w, uint256.NewInt(7))
+	}
+
+	tests := []struct {
+		op   OpCode
+		y, x int64
+		want int64
+	}{
+		{SDIV, -17, 5, -3},
+		{SDIV, 17, -5, -3},
+		{SDIV, -17, 0, 0},
+		{SMOD, -17, 5, -2},
+		{SMOD, 17, -5, 2},
+		{SMOD, -17, 0, 0},
+		{SLT, -1, 1, 1},
+		{SLT, 1, -1, 0},
+		{SGT, 1, -1, 1},
+		{SGT, -1, 1, 0},
+		{SAR, -17, 2, -5},
+		{SAR, -17, 300, -1},
+		{SAR, 17, 300, 0},
+	}
+
+	for _, tt := range tests {
+		e := New(NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: word(tt.y)},
+			{OpCode: PUSH, Operand: word(tt.x)},
+			{OpCode: tt.op},
+			{OpCode: STOP},
+		}, nil))
+
+		_, err := e.Run(nil, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, word(tt.want), e.stack[1], "%s %d %d", OpCodes[tt.op], tt.y, tt.x)
+	}
+
+	// math.MaxInt64 + 1 wraps around like int64
+	e := New(NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: word(9223372036854775807)},
+		{OpCode: PUSH, Operand: word(1)},
+		{OpCode: ADD},
+		{OpCode: SIGNEXTEND, Operand: *uint256.NewInt(7)},
+		{OpCode: STOP},
+	}, nil))
+	_, err := e.Run(nil, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, word(-9223372036854775808), e.stack[1])
+}
+
+func Test_HashNatives(t *testing.T) {
+	hashOf := func(prog Program) string {
+		e := New(prog)
+		_, err := e.Run(nil, 1000)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, e.stackSize)
+		return e.stack[1].Hex()
+	}
+
+	str := func(id uint64) Program {
+		return NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+			{OpCode: PUSH, Operand: *uint256.NewInt(5)},
+			{OpCode: NATIVE, Operand: *uint256.NewInt(id)},
+			{OpCode: STOP},
+		}, []byte("hello"))
+	}
+	assert.Equal(t, "0x1c8aff950685c2ed4bc3174f3472287b56d9517b9c948127319a09a7a36deac8", hashOf(str(NativeKeccak256Str)))
+	assert.Equal(t, "0x2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hashOf(str(NativeSha256Str)))
+
+	word := func(id uint64) Program {
+		return NewProgram([]Instruction{
+			{OpCode: PUSH, Operand: *uint256.NewInt(42)},
+			{OpCode: NATIVE, Operand: *uint256.NewInt(id)},
+			{OpCode: STOP},
+		}, nil)
+	}
+	assert.Equal(t, "0xbeced09521047d05b8960b7e7bcc1d1292cf3e4b2a6b63f48335cbde5f7545d2", hashOf(word(NativeKeccak256)))
+	assert.NotEqual(t, hashOf(word(NativeKeccak256)), hashOf(word(NativeSha256)))
+}
+
+func ecrecoverProgram(hash []byte, v uint64, r, s []byte) Program {
+	return NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *new(uint256.Int).SetBytes(hash)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(v)},
+		{OpCode: PUSH, Operand: *new(uint256.Int).SetBytes(r)},
+		{OpCode: PUSH, Operand: *new(uint256.Int).SetBytes(s)},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(NativeEcrecover)},
+		{OpCode: STOP},
+	}, nil)
+}
+
+func Test_Ecrecover(t *testing.T) {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	assert.NoError(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	hash := crypto.Keccak256([]byte("permit"))
+	sig, err := crypto.Sign(hash, key)
+	assert.NoError(t, err)
+
+	recover := func(prog Program) common.Address {
+		e := New(prog)
+		_, err := e.Run(nil, 1000)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, e.stackSize)
+		return common.Address(e.stack[1].Bytes20())
+	}
+
+	assert.Equal(t, signer, recover(ecrecoverProgram(hash, uint64(sig[64])+27, sig[:32], sig[32:64])))
+	assert.Equal(t, signer, recover(ecrecoverProgram(hash, uint64(sig[64]), sig[:32], sig[32:64])))
+
+	// wrong v, malformed r and other hash don't recover the signer
+	assert.Equal(t, common.Address{}, recover(ecrecoverProgram(hash, 29, sig[:32], sig[32:64])))
+	assert.Equal(t, common.Address{}, recover(ecrecoverProgram(hash, uint64(sig[64])+27, nil, sig[32:64])))
+	assert.NotEqual(t, signer, recover(ecrecoverProgram(crypto.Keccak256([]byte("other")), uint64(sig[64])+27, sig[:32], sig[32:64])))
+}
+
+func Test_RunOutput(t *testing.T) {
+	// writef("%d %s\n", -7, "ok") and write("done")
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(6)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+		{OpCode: PUSH, Operand: *new(uint256.Int).Neg(uint256.NewInt(7))},
+		{OpCode: PUSH, Operand: *uint256.NewInt(0)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(6)},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(NativeWriteF)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(8)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(4)},
+		{OpCode: NATIVE, Operand: *uint256.NewInt(NativeWrite)},
+		{OpCode: STOP},
+	}, []byte("%d %s\nokdone"))
+
+	var out bytes.Buffer
+	e := New(prog).WithOutput(&out)
+	for i := 0; i < 2; i++ {
+		res, err := e.Run(nil, 10_000)
+		assert.NoError(t, err)
+		assert.Equal(t, "-7 ok\ndone", string(res.Output))
+	}
+	assert.Equal(t, "-7 ok\ndone-7 ok\ndone", out.String())
+}
+
+func Test_RunReturn(t *testing.T) {
+	// returns 4 bytes of preallocated memory starting at 2
+	prog := NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(2)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(4)},
+		{OpCode: RETURN},
+	}, []byte("xxdatayy"))
+
+	e, err := NewVerified(prog)
+	assert.NoError(t, err)
+	res, err := e.Run(nil, 10_000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), res.ReturnData)
+
+	// out of memory range
+	prog = NewProgram([]Instruction{
+		{OpCode: PUSH, Operand: *uint256.NewInt(MemoryCapacity - 2)},
+		{OpCode: PUSH, Operand: *uint256.NewInt(4)},
+		{OpCode: RETURN},
+	}, nil)
+	res, err = New(prog).Run(nil, 10_000)
+	assert.ErrorIs(t, err, errInvalidMemoryAccess)
+	assert.Nil(t, res.ReturnData)
+
+	// stopped without RETURN
+	res, err = New(NewProgram([]Instruction{{OpCode: STOP}}, nil)).Run(nil, 10_000)
+	assert.NoError(t, err)
+	assert.Nil(t, res.ReturnData)
+}
+
+func Test_writefVerbs(t *testing.T) {
+	assert.Equal(t, []string{"%d", "%s"}, writefVerbs("%d %s\n"))
+	assert.Equal(t, []string{"%v", "%x"}, writefVerbs("hash: %v, 100%% address: %x"))
+	assert.Nil(t, writefVerbs("no verbs %"))
+	assert.Equal(t, 3, writefArgsSize("%s%d"))
+}
+
 func Benchmark_exec(b *testing.B) {
 }
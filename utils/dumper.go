@@ -1,8 +1,7 @@
 package utils
 
 import (
-	"encoding/gob"
-	"log"
+	"fmt"
 	"os"
 
 	"github.com/Unheilbar/eulang/eulvm"
@@ -10,43 +9,26 @@ import (
 
 //TODO it's just a prove of conception. eulang later come up with a better package name
 
-func DumpProgramIntoFile(filename string, program eulvm.Program) (err error) {
-	fi, err := os.Create(filename)
+// DumpProgramIntoFile writes the program into file in eulvm bytecode format
+func DumpProgramIntoFile(filename string, program eulvm.Program) error {
+	data, err := program.MarshalBinary()
 	if err != nil {
-		return err
-	}
-	gob.Register(program)
-	defer func() {
-		if err := fi.Close(); err != nil {
-			log.Fatal("can't close file", err)
-		}
-	}()
-
-	err = gob.NewEncoder(fi).Encode(program)
-	if err != nil {
-		log.Fatalf("can't encode program into file %s err %s", filename, err)
+		return fmt.Errorf("can't encode program into file %s: %w", filename, err)
 	}
 
-	return nil
+	return os.WriteFile(filename, data, 0644)
 }
 
+// LoadProgramFromFile reads the program written by DumpProgramIntoFile
 func LoadProgramFromFile(filename string) (eulvm.Program, error) {
-	fi, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return eulvm.Program{}, err
 	}
-	defer func() {
-		if err := fi.Close(); err != nil {
-			log.Fatal("can't close file", err)
-		}
-	}()
 
 	var program eulvm.Program
-
-	err = gob.NewDecoder(fi).Decode(&program)
-
-	if err != nil {
-		log.Fatalf("can't decode file %s err %s", filename, err)
+	if err := program.UnmarshalBinary(data); err != nil {
+		return eulvm.Program{}, fmt.Errorf("can't decode file %s: %w", filename, err)
 	}
 
 	return program, nil